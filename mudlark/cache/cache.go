@@ -0,0 +1,194 @@
+// Copyright 2010 -- Peter Williams, all rights reserved
+// Use of this source code is governed by the new BSD license.
+
+// The cache package implements key/value caches whose entries can expire
+// after a given time to live and which discard their least recently used
+// entries when they are full.  The entries are kept in left leaning red black
+// trees (see mudlark/tree/llrb_tree) ordered by expiry time and by recency of
+// use so that the next entry to be discarded is always the first in one of
+// them.
+package cache;
+
+import (
+	"time";
+	"mudlark/tree/llrb_tree";
+);
+
+// The reasons for discarding an entry passed to the eviction callback.
+const (
+	// its time to live ran out
+	EXPIRED = iota;
+	// it was the least recently used entry in a full cache
+	EVICTED;
+);
+
+type entry struct {
+	key, value interface{};
+	// the time (in nanoseconds) at which the entry expires (0 means never)
+	expires int64;
+	// when the entry was last used (a sequence number unique to the entry)
+	used uint64;
+};
+
+// Orders entries by expiry time (entries with the same expiry time being
+// ordered by recency).
+type by_expiry struct {
+	*entry;
+};
+
+func (this by_expiry) Precedes(other interface{}) bool {
+	that := other.(by_expiry);
+	if this.expires != that.expires {
+		return this.expires < that.expires;
+	};
+	return this.used < that.used;
+};
+
+// Orders entries from least to most recently used.
+type by_recency struct {
+	*entry;
+};
+
+func (this by_recency) Precedes(other interface{}) bool {
+	return this.used < other.(by_recency).used;
+};
+
+// Cache maps keys to values.  Keys must be usable as map keys.  Instances of
+// Cache must be created using Make().
+type Cache struct {
+	entries map[interface{}]*entry;
+	// the entries that have a time to live
+	expiry *llrb_tree.Tree;
+	recency *llrb_tree.Tree;
+	last_used uint64;
+	capacity uint;
+	evicted func(key, value interface{}, reason int);
+	clock func() int64;
+};
+
+// Make a Cache that holds at most capacity entries (0 means no limit).
+func Make(capacity uint) (cache *Cache) {
+	cache = new(Cache);
+	cache.entries = make(map[interface{}]*entry);
+	cache.expiry = llrb_tree.Make(true);
+	cache.recency = llrb_tree.Make(true);
+	cache.capacity = capacity;
+	cache.clock = time.Nanoseconds;
+	return;
+};
+
+// SetEvictionCallback sets a function to be called with the key and value of
+// each entry that is discarded because it expired (reason == EXPIRED) or
+// because the cache was full (reason == EVICTED).  It is not called for
+// entries removed by Delete() or replaced by Set().
+func (this *Cache) SetEvictionCallback(evicted func(key, value interface{}, reason int)) {
+	this.evicted = evicted;
+};
+
+// SetClock replaces the function used to find the current time (in
+// nanoseconds).  The default is time.Nanoseconds.
+func (this *Cache) SetClock(clock func() int64) {
+	this.clock = clock;
+};
+
+func (this *Cache) remove(e *entry) {
+	this.entries[e.key] = nil, false;
+	if e.expires != 0 {
+		this.expiry.Delete(by_expiry{e});
+	};
+	this.recency.Delete(by_recency{e});
+};
+
+func (this *Cache) evict(e *entry, reason int) {
+	this.remove(e);
+	if this.evicted != nil {
+		this.evicted(e.key, e.value, reason);
+	};
+};
+
+// Mark e as the most recently used entry.
+func (this *Cache) touch(e *entry) {
+	this.recency.Delete(by_recency{e});
+	if e.expires != 0 {
+		this.expiry.Delete(by_expiry{e});
+	};
+	this.last_used++;
+	e.used = this.last_used;
+	this.recency.Insert(by_recency{e});
+	if e.expires != 0 {
+		this.expiry.Insert(by_expiry{e});
+	};
+};
+
+// Get the value associated with key.  If there is no such entry, or it has
+// expired, found is false.  A successful Get() makes the entry the most
+// recently used.
+func (this *Cache) Get(key interface{}) (value interface{}, found bool) {
+	e, found := this.entries[key];
+	if !found {
+		return;
+	};
+	if e.expires != 0 && e.expires <= this.clock() {
+		this.evict(e, EXPIRED);
+		return nil, false;
+	};
+	this.touch(e);
+	return e.value, true;
+};
+
+// Set associates value with key replacing any existing entry for key.  The
+// entry expires ttl nanoseconds from now unless ttl is 0 in which case it
+// only leaves the cache when evicted or deleted.  If the cache is full any
+// expired entries are discarded and then, if that doesn't make room for it,
+// the least recently used entry is evicted.
+func (this *Cache) Set(key, value interface{}, ttl int64) {
+	if e, found := this.entries[key]; found {
+		this.remove(e);
+	};
+	e := &entry{key: key, value: value};
+	if ttl != 0 {
+		e.expires = this.clock() + ttl;
+	};
+	this.entries[key] = e;
+	this.touch(e);
+	if this.capacity != 0 && this.recency.Len() > this.capacity {
+		this.Sweep();
+	};
+	for this.capacity != 0 && this.recency.Len() > this.capacity {
+		oldest, _ := this.recency.Min();
+		this.evict(oldest.(by_recency).entry, EVICTED);
+	};
+};
+
+// Delete the entry for key (if any).
+func (this *Cache) Delete(key interface{}) {
+	if e, found := this.entries[key]; found {
+		this.remove(e);
+	};
+};
+
+// Len returns the number of entries in the cache including any that have
+// expired but have not yet been discarded.
+func (this *Cache) Len() uint {
+	return this.recency.Len();
+};
+
+// Sweep discards all expired entries and returns how many there were.
+// Expired entries are otherwise only discarded when Get() finds them or
+// Set() needs room.
+func (this *Cache) Sweep() (n uint) {
+	now := this.clock();
+	for {
+		first, found := this.expiry.Min();
+		if !found || first.(by_expiry).expires > now {
+			return;
+		};
+		e := first.(by_expiry).entry;
+		this.expiry.DeleteMin();
+		// so that remove() doesn't look for it in the expiry tree again
+		e.expires = 0;
+		this.evict(e, EXPIRED);
+		n++;
+	};
+	return;
+};
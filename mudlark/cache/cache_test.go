@@ -0,0 +1,140 @@
+// Copyright 2010 -- Peter Williams, all rights reserved
+// Use of this source code is governed by the new BSD license.
+
+package cache;
+
+import (
+	"testing";
+	"fmt";
+);
+
+type clock struct {
+	now int64;
+};
+
+func (this *clock) time() int64 {
+	return this.now;
+};
+
+type eviction struct {
+	key interface{};
+	reason int;
+};
+
+func make_cache(capacity uint) (cache *Cache, c *clock, evictions *[]eviction) {
+	cache = Make(capacity);
+	c = &clock{1000};
+	cache.SetClock(func() int64 { return c.time(); });
+	evictions = new([]eviction);
+	cache.SetEvictionCallback(func(key, value interface{}, reason int) {
+		*evictions = append(*evictions, eviction{key, reason});
+	});
+	return;
+};
+
+func check_evictions(t *testing.T, evictions *[]eviction, expected ...eviction) {
+	if fmt.Sprint(*evictions) != fmt.Sprint(expected) {
+		t.Errorf("Expected evictions %v: got %v", expected, *evictions);
+	};
+	*evictions = nil;
+};
+
+func TestGetSet(t *testing.T) {
+	cache, _, evictions := make_cache(0);
+	cache.Set("a", 1, 0);
+	cache.Set("b", 2, 0);
+	cache.Set("a", 3, 0);
+	if v, found := cache.Get("a"); !found || v != 3 {
+		t.Errorf("Expected 3: got %v %v", v, found);
+	};
+	if _, found := cache.Get("c"); found {
+		t.Errorf("Found absent key");
+	};
+	cache.Delete("b");
+	if _, found := cache.Get("b"); found {
+		t.Errorf("Found deleted key");
+	};
+	if cache.Len() != 1 {
+		t.Errorf("Expected 1 entry: got %v", cache.Len());
+	};
+	check_evictions(t, evictions);
+};
+
+func TestCapacity(t *testing.T) {
+	cache, _, evictions := make_cache(3);
+	cache.Set(1, 1, 0);
+	cache.Set(2, 2, 0);
+	cache.Set(3, 3, 0);
+	cache.Get(1);
+	cache.Set(4, 4, 0);
+	check_evictions(t, evictions, eviction{2, EVICTED});
+	cache.Set(3, 30, 0);
+	cache.Set(5, 5, 0);
+	check_evictions(t, evictions, eviction{1, EVICTED});
+	for _, key := range []int{3, 4, 5} {
+		if _, found := cache.Get(key); !found {
+			t.Errorf("Expected %v to be cached", key);
+		};
+	};
+	if cache.Len() != 3 {
+		t.Errorf("Expected 3 entries: got %v", cache.Len());
+	};
+};
+
+func TestCapacityExpired(t *testing.T) {
+	cache, clock, evictions := make_cache(2);
+	cache.Set(1, 1, 0);
+	cache.Set(2, 2, 50);
+	clock.now += 60;
+	cache.Set(3, 3, 0);
+	check_evictions(t, evictions, eviction{2, EXPIRED});
+	if _, found := cache.Get(1); !found {
+		t.Errorf("Expected 1 to be cached");
+	};
+};
+
+func TestExpiry(t *testing.T) {
+	cache, clock, evictions := make_cache(0);
+	cache.Set("a", 1, 100);
+	cache.Set("b", 2, 50);
+	cache.Set("c", 3, 0);
+	cache.Set("d", 4, 200);
+	clock.now += 60;
+	if _, found := cache.Get("b"); found {
+		t.Errorf("Found expired entry");
+	};
+	check_evictions(t, evictions, eviction{"b", EXPIRED});
+	if v, found := cache.Get("a"); !found || v != 1 {
+		t.Errorf("Expected 1: got %v %v", v, found);
+	};
+	clock.now += 1000;
+	if n := cache.Sweep(); n != 2 {
+		t.Errorf("Expected 2 entries swept: got %v", n);
+	};
+	check_evictions(t, evictions, eviction{"a", EXPIRED}, eviction{"d", EXPIRED});
+	if v, found := cache.Get("c"); !found || v != 3 {
+		t.Errorf("Expected 3: got %v %v", v, found);
+	};
+	if cache.Len() != 1 || cache.expiry.Len() != 0 {
+		t.Errorf("Expected 1 entry: got %v", cache.Len());
+	};
+};
+
+func TestExpiryReset(t *testing.T) {
+	cache, clock, evictions := make_cache(0);
+	cache.Set("a", 1, 100);
+	clock.now += 90;
+	cache.Set("a", 2, 100);
+	clock.now += 90;
+	cache.Sweep();
+	if v, found := cache.Get("a"); !found || v != 2 {
+		t.Errorf("Expected 2: got %v %v", v, found);
+	};
+	cache.Set("a", 3, 0);
+	clock.now += 1000;
+	cache.Sweep();
+	if _, found := cache.Get("a"); !found {
+		t.Errorf("Entry without time to live expired");
+	};
+	check_evictions(t, evictions);
+};
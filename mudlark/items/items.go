@@ -0,0 +1,163 @@
+// Copyright 2010 -- Peter Williams, all rights reserved
+// Use of this source code is governed by the new BSD license.
+
+// The items package implements the Item interface (as used by
+// mudlark/tree/llrb_tree, mudlark/set/heteroset and mudlark/sort) for the
+// builtin numeric and string types, byte slices and times along with
+// wrappers for reversing the order of items and for ordering by several
+// fields.
+package items;
+
+import (
+	"bytes";
+	"time";
+);
+
+// Item is the interface implemented by all of the types in this package.
+type Item interface {
+	Precedes(other interface{}) bool;
+};
+
+type Int int;
+
+func (this Int) Precedes(other interface{}) bool {
+	return this < other.(Int);
+};
+
+type Int8 int8;
+
+func (this Int8) Precedes(other interface{}) bool {
+	return this < other.(Int8);
+};
+
+type Int16 int16;
+
+func (this Int16) Precedes(other interface{}) bool {
+	return this < other.(Int16);
+};
+
+type Int32 int32;
+
+func (this Int32) Precedes(other interface{}) bool {
+	return this < other.(Int32);
+};
+
+type Int64 int64;
+
+func (this Int64) Precedes(other interface{}) bool {
+	return this < other.(Int64);
+};
+
+type Uint uint;
+
+func (this Uint) Precedes(other interface{}) bool {
+	return this < other.(Uint);
+};
+
+type Uint8 uint8;
+
+func (this Uint8) Precedes(other interface{}) bool {
+	return this < other.(Uint8);
+};
+
+type Uint16 uint16;
+
+func (this Uint16) Precedes(other interface{}) bool {
+	return this < other.(Uint16);
+};
+
+type Uint32 uint32;
+
+func (this Uint32) Precedes(other interface{}) bool {
+	return this < other.(Uint32);
+};
+
+type Uint64 uint64;
+
+func (this Uint64) Precedes(other interface{}) bool {
+	return this < other.(Uint64);
+};
+
+type Uintptr uintptr;
+
+func (this Uintptr) Precedes(other interface{}) bool {
+	return this < other.(Uintptr);
+};
+
+// NaNs precede all other values and are equal to each other (so that the
+// ordering satisfies the formal requirements of Item).  Zero and negative
+// zero are equal.
+func float_precedes(a, b float64) bool {
+	if a != a {
+		return b == b;
+	};
+	return a < b;
+};
+
+// Float32 is ordered numerically except for NaNs (see Float64).
+type Float32 float32;
+
+func (this Float32) Precedes(other interface{}) bool {
+	return float_precedes(float64(this), float64(other.(Float32)));
+};
+
+// Float64 is ordered numerically except that NaNs precede all other values
+// (including negative infinity) and are all equal to each other.
+type Float64 float64;
+
+func (this Float64) Precedes(other interface{}) bool {
+	return float_precedes(float64(this), float64(other.(Float64)));
+};
+
+// String is ordered lexically by byte.
+type String string;
+
+func (this String) Precedes(other interface{}) bool {
+	return this < other.(String);
+};
+
+// Bytes is ordered lexically by byte.  As slices can't be compared with ==
+// (comparing interfaces that hold Bytes panics) Bytes values can't be used
+// where values are compared that way (e.g. as the values in a spatial.Index).
+type Bytes []byte;
+
+func (this Bytes) Precedes(other interface{}) bool {
+	return bytes.Compare(this, other.(Bytes)) < 0;
+};
+
+// Time is ordered chronologically.  The ordering uses Seconds() so it has a
+// resolution of one second.
+type Time struct {
+	*time.Time;
+};
+
+func (this Time) Precedes(other interface{}) bool {
+	return this.Seconds() < other.(Time).Seconds();
+};
+
+// Reverse reverses the ordering of the wrapped Item.
+type Reverse struct {
+	Item;
+};
+
+func (this Reverse) Precedes(other interface{}) bool {
+	return other.(Reverse).Item.Precedes(this.Item);
+};
+
+// Tuple is ordered lexicographically by its elements (which must be of the
+// same types in the same positions in all tuples being compared) with a
+// tuple that is a prefix of another preceding it.  Like Bytes, tuples can't
+// be compared with ==.
+type Tuple []Item;
+
+func (this Tuple) Precedes(other interface{}) bool {
+	that := other.(Tuple);
+	for i := 0; i < len(this) && i < len(that); i++ {
+		if this[i].Precedes(that[i]) {
+			return true;
+		} else if that[i].Precedes(this[i]) {
+			return false;
+		};
+	};
+	return len(this) < len(that);
+};
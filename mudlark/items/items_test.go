@@ -0,0 +1,83 @@
+// Copyright 2010 -- Peter Williams, all rights reserved
+// Use of this source code is governed by the new BSD license.
+
+package items_test;
+
+import (
+	"testing";
+	"fmt";
+	"math";
+	"time";
+	"mudlark/items";
+	"mudlark/set/heteroset";
+	"mudlark/sort";
+	"mudlark/tree/llrb_tree";
+);
+
+func sorted(values ...sort.Item) string {
+	return fmt.Sprint(sort.SortSlice(values));
+};
+
+func check(t *testing.T, what, expected, got string) {
+	if expected != got {
+		t.Errorf("%v: expected %v got %v", what, expected, got);
+	};
+};
+
+func TestNumbers(t *testing.T) {
+	check(t, "Int", "[-3 0 2]", sorted(items.Int(2), items.Int(-3), items.Int(0)));
+	check(t, "Int8", "[-128 0 127]", sorted(items.Int8(127), items.Int8(-128), items.Int8(0)));
+	check(t, "Uint64", "[0 1 18446744073709551615]", sorted(items.Uint64(math.MaxUint64), items.Uint64(0), items.Uint64(1)));
+	check(t, "Float32", "[NaN -1.5 2]", sorted(items.Float32(2), items.Float32(math.NaN()), items.Float32(-1.5)));
+	nan := items.Float64(math.NaN());
+	check(t, "Float64", "[NaN NaN -Inf 0 1 +Inf]", sorted(items.Float64(1), nan, items.Float64(math.Inf(1)), items.Float64(0), nan, items.Float64(math.Inf(-1))));
+	if nan.Precedes(nan) {
+		t.Errorf("NaN precedes itself");
+	};
+	tree := llrb_tree.Make(true);
+	tree.Insert(nan);
+	tree.Insert(items.Float64(math.NaN()));
+	tree.Insert(items.Float64(0));
+	tree.Insert(items.Float64(math.Copysign(0, -1)));
+	if tree.Len() != 2 {
+		t.Errorf("Expected NaNs and zeroes to be equal: got %v items", tree.Len());
+	};
+};
+
+func TestStrings(t *testing.T) {
+	check(t, "String", "[ B a ab b]", sorted(items.String("b"), items.String("ab"), items.String(""), items.String("a"), items.String("B")));
+	check(t, "Bytes", "[[] [1] [1 0] [2]]", sorted(items.Bytes{2}, items.Bytes{1, 0}, items.Bytes{}, items.Bytes{1}));
+};
+
+func TestTime(t *testing.T) {
+	a := items.Time{time.SecondsToUTC(1000)};
+	b := items.Time{time.SecondsToUTC(2000)};
+	if !a.Precedes(b) || b.Precedes(a) || a.Precedes(a) {
+		t.Errorf("Times out of order");
+	};
+};
+
+func TestReverse(t *testing.T) {
+	check(t, "Reverse", "[{3} {2} {1}]", sorted(items.Reverse{items.Int(1)}, items.Reverse{items.Int(3)}, items.Reverse{items.Int(2)}));
+};
+
+func TestTuple(t *testing.T) {
+	a := items.Tuple{items.String("x"), items.Int(2)};
+	b := items.Tuple{items.String("x"), items.Int(10)};
+	c := items.Tuple{items.String("w"), items.Int(99)};
+	d := items.Tuple{items.String("x")};
+	e := items.Tuple{items.String("x"), items.Reverse{items.Int(5)}};
+	f := items.Tuple{items.String("x"), items.Reverse{items.Int(7)}};
+	check(t, "Tuple", "[[w 99] [x] [x 2] [x 10]]", sorted(b, d, a, c));
+	check(t, "Tuple Reverse", "[[x {7}] [x {5}]]", sorted(e, f));
+};
+
+func TestHeteroset(t *testing.T) {
+	set := heteroset.New(items.Int(2), items.String("a"), items.Int(1), items.String("a"), items.Float64(0.5));
+	if set.Cardinality() != 4 {
+		t.Errorf("Expected 4 members: got %v", set.Cardinality());
+	};
+	if !set.Has(items.Int(1)) || set.Has(items.Int64(1)) {
+		t.Errorf("Membership depends on type");
+	};
+};
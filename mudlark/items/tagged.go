@@ -0,0 +1,243 @@
+// Copyright 2010 -- Peter Williams, all rights reserved
+// Use of this source code is governed by the new BSD license.
+
+package items;
+
+import (
+	"os";
+	"reflect";
+	"strconv";
+	"strings";
+	"sync";
+);
+
+// The kinds of field that can be used to order structs.
+const (
+	kind_int = iota;
+	kind_uint;
+	kind_float;
+	kind_string;
+	kind_bool;
+	// the field's values implement Item
+	kind_item;
+);
+
+type field struct {
+	index int;
+	kind int;
+	order int;
+	desc bool;
+};
+
+// How the values of a struct type are ordered: by the fields in order.
+type ordering struct {
+	fields []field;
+};
+
+// The orderings of the struct types that have been used with ByTags().
+var orderings struct {
+	sync.Mutex;
+	cache map[reflect.Type]*ordering;
+};
+
+// Find the value of key in a struct tag of the form `key:"value" ...`.
+func tag_value(tag, key string) (value string, found bool) {
+	for tag != "" {
+		i := strings.Index(tag, ":\"");
+		if i < 0 {
+			return;
+		};
+		name := strings.TrimSpace(tag[0:i]);
+		tag = tag[i + 2:];
+		j := strings.Index(tag, "\"");
+		if j < 0 {
+			return;
+		};
+		if name == key {
+			return tag[0:j], true;
+		};
+		tag = tag[j + 1:];
+	};
+	return;
+};
+
+func tag_error(t reflect.Type, name, problem string) os.Error {
+	return os.NewError("items: " + t.String() + "." + name + ": " + problem);
+};
+
+func field_kind(t reflect.Type) int {
+	switch t.(type) {
+	case *reflect.IntType:
+		return kind_int;
+	case *reflect.UintType:
+		return kind_uint;
+	case *reflect.FloatType:
+		return kind_float;
+	case *reflect.StringType:
+		return kind_string;
+	case *reflect.BoolType:
+		return kind_bool;
+	};
+	return kind_item;
+};
+
+// Whether the values of type t implement Item.  An interface type must
+// itself declare Precedes() as its nil value can't show what its dynamic
+// values will implement.
+func implements_item(t reflect.Type) bool {
+	if it, ok := t.(*reflect.InterfaceType); ok {
+		for i := 0; i < it.NumMethod(); i++ {
+			if it.Method(i).Name == "Precedes" {
+				return true;
+			};
+		};
+		return false;
+	};
+	_, ok := reflect.MakeZero(t).Interface().(Item);
+	return ok;
+};
+
+func make_ordering(t reflect.Type) (o *ordering, err os.Error) {
+	st, ok := t.(*reflect.StructType);
+	if !ok {
+		return nil, os.NewError("items: " + t.String() + " is not a struct type");
+	};
+	o = new(ordering);
+	for i := 0; i < st.NumField(); i++ {
+		f := st.Field(i);
+		tag, found := tag_value(f.Tag, "mudlark");
+		if !found {
+			continue;
+		};
+		fld := field{index: i, kind: field_kind(f.Type), order: -1};
+		if fld.kind == kind_item && !implements_item(f.Type) {
+			return nil, tag_error(t, f.Name, "type " + f.Type.String() + " can't be ordered");
+		};
+		for _, option := range strings.Split(tag, ",", -1) {
+			switch {
+			case option == "desc":
+				fld.desc = true;
+			case option == "asc":
+				fld.desc = false;
+			case strings.HasPrefix(option, "order="):
+				if fld.order, err = strconv.Atoi(option[6:]); err != nil || fld.order < 0 {
+					return nil, tag_error(t, f.Name, "bad order \"" + option[6:] + "\"");
+				};
+			default:
+				return nil, tag_error(t, f.Name, "unknown option \"" + option + "\"");
+			};
+		};
+		if fld.order < 0 {
+			return nil, tag_error(t, f.Name, "no order given");
+		};
+		// Insert the field in order.
+		j := len(o.fields);
+		o.fields = append(o.fields, fld);
+		for ; j > 0 && o.fields[j - 1].order >= fld.order; j-- {
+			if o.fields[j - 1].order == fld.order {
+				return nil, tag_error(t, f.Name, "duplicate order " + strconv.Itoa(fld.order));
+			};
+			o.fields[j] = o.fields[j - 1];
+		};
+		o.fields[j] = fld;
+	};
+	return;
+};
+
+// The ordering of the struct that value is (or points to).  Orderings are
+// cached so the reflection is only done once per type.
+func ordering_of(value interface{}) (*reflect.StructValue, *ordering) {
+	v := reflect.NewValue(value);
+	if pv, ok := v.(*reflect.PtrValue); ok {
+		v = pv.Elem();
+	};
+	orderings.Lock();
+	defer orderings.Unlock();
+	o, found := orderings.cache[v.Type()];
+	if !found {
+		var err os.Error;
+		if o, err = make_ordering(v.Type()); err != nil {
+			panic(err);
+		};
+		if orderings.cache == nil {
+			orderings.cache = make(map[reflect.Type]*ordering);
+		};
+		orderings.cache[v.Type()] = o;
+	};
+	return v.(*reflect.StructValue), o;
+};
+
+// Tagged is an Item whose ordering is derived from the struct tags of the
+// struct that it holds.  Instances must be created using ByTags().
+type Tagged struct {
+	// the struct (or pointer to a struct) being ordered
+	Value interface{};
+	value *reflect.StructValue;
+	ordering *ordering;
+};
+
+// ByTags wraps value (a struct or a pointer to a struct) as an Item ordered by
+// the struct's fields that have tags of the form:
+//	`mudlark:"order=N"` or `mudlark:"order=N,desc"`
+// The fields are compared in increasing order of N and those marked "desc"
+// are compared in descending order.  Fields of integer, floating point (with
+// NaNs ordered as by Float64), string and bool (false first) types are
+// compared directly and fields of any other type must implement Item.
+// Untagged fields are ignored.  All of the Tagged items being compared with
+// each other must hold the same struct type.
+//
+// The ordering of each struct type is derived (using reflection) the first
+// time that it is used and then cached.  ByTags() panics if the type is not
+// a struct type, its tags are malformed or a tagged field's type can't be
+// ordered.
+func ByTags(value interface{}) Tagged {
+	v, o := ordering_of(value);
+	return Tagged{value, v, o};
+};
+
+// Returns <0, 0 or >0 depending on whether a's field comes before, is equal
+// to or comes after b's.
+func compare_fields(f field, a, b reflect.Value) int {
+	var lt, gt bool;
+	switch f.kind {
+	case kind_int:
+		x, y := a.(*reflect.IntValue).Get(), b.(*reflect.IntValue).Get();
+		lt, gt = x < y, y < x;
+	case kind_uint:
+		x, y := a.(*reflect.UintValue).Get(), b.(*reflect.UintValue).Get();
+		lt, gt = x < y, y < x;
+	case kind_float:
+		x, y := a.(*reflect.FloatValue).Get(), b.(*reflect.FloatValue).Get();
+		lt, gt = float_precedes(x, y), float_precedes(y, x);
+	case kind_string:
+		x, y := a.(*reflect.StringValue).Get(), b.(*reflect.StringValue).Get();
+		lt, gt = x < y, y < x;
+	case kind_bool:
+		x, y := a.(*reflect.BoolValue).Get(), b.(*reflect.BoolValue).Get();
+		lt, gt = !x && y, x && !y;
+	case kind_item:
+		x, y := a.Interface().(Item), b.Interface();
+		lt, gt = x.Precedes(y), y.(Item).Precedes(x);
+	};
+	switch {
+	case lt:
+		return -1;
+	case gt:
+		return 1;
+	};
+	return 0;
+};
+
+func (this Tagged) Precedes(other interface{}) bool {
+	that := other.(Tagged);
+	for _, f := range this.ordering.fields {
+		c := compare_fields(f, this.value.Field(f.index), that.value.Field(f.index));
+		if f.desc {
+			c = -c;
+		};
+		if c != 0 {
+			return c < 0;
+		};
+	};
+	return false;
+};
@@ -0,0 +1,82 @@
+// Copyright 2010 -- Peter Williams, all rights reserved
+// Use of this source code is governed by the new BSD license.
+
+package items_test;
+
+import (
+	"testing";
+	"fmt";
+	"mudlark/items";
+	"mudlark/sort";
+	"mudlark/tree/llrb_tree";
+);
+
+type record struct {
+	Name string `mudlark:"order=2"`;
+	Priority int `mudlark:"order=1,desc"`;
+	Size float64;
+	Done bool `mudlark:"order=0"`;
+	Owner items.String `mudlark:"order=3"`;
+};
+
+func (this record) String() string {
+	return fmt.Sprintf("%v/%v/%v/%v", this.Done, this.Priority, this.Name, this.Owner);
+};
+
+func TestByTags(t *testing.T) {
+	records := []record{
+		record{"b", 1, 0, false, "x"},
+		record{"a", 1, 9, false, "x"},
+		record{"c", 5, 0, true, "x"},
+		record{"a", 3, 0, false, "y"},
+		record{"a", 3, 1, false, "x"},
+	};
+	var slice []sort.Item;
+	for _, r := range records {
+		slice = append(slice, items.ByTags(r));
+	};
+	var got []interface{};
+	for _, item := range sort.SortSlice(slice) {
+		got = append(got, item.(items.Tagged).Value);
+	};
+	check(t, "ByTags", "[false/3/a/x false/3/a/y false/1/a/x false/1/b/x true/5/c/x]", fmt.Sprint(got));
+	// Size isn't tagged so these are equal.
+	tree := llrb_tree.Make(true);
+	tree.Insert(items.ByTags(&records[4]));
+	tree.Insert(items.ByTags(&record{"a", 3, 2, false, "x"}));
+	if tree.Len() != 1 {
+		t.Errorf("Untagged field used in ordering");
+	};
+};
+
+func expect_panic(t *testing.T, value interface{}) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected %T to be rejected", value);
+		};
+	}();
+	items.ByTags(value);
+};
+
+func TestByTagsErrors(t *testing.T) {
+	expect_panic(t, 1);
+	expect_panic(t, struct {
+		A int `mudlark:"desc"`;
+	}{});
+	expect_panic(t, struct {
+		A int `mudlark:"order=x"`;
+	}{});
+	expect_panic(t, struct {
+		A int `mudlark:"order=1,up"`;
+	}{});
+	expect_panic(t, struct {
+		A int `mudlark:"order=1"`;
+		B int `mudlark:"order=1"`;
+	}{});
+	expect_panic(t, struct {
+		A []int `mudlark:"order=1"`;
+	}{});
+	expect_panic(t, struct {
+		A interface{} `mudlark:"order=1"`;
+	}{});
+};
@@ -0,0 +1,148 @@
+// Copyright 2010 -- Peter Williams, all rights reserved
+// Use of this source code is governed by the new BSD license.
+
+// The merge package implements iteration in order over the union of the
+// contents of several trees (see mudlark/tree/llrb_tree) or sets (see
+// mudlark/set/heteroset) without copying them.  The next item from each
+// source is kept in a heap so each item emitted costs O(log K) comparisons
+// where K is the number of sources, and the sources are only read as fast as
+// the merged items are consumed.
+package merge;
+
+import (
+	"container/heap";
+	"mudlark/set/heteroset";
+	"mudlark/tree/llrb_tree";
+);
+
+// Item is the interface implemented by the items of both trees and sets.
+type Item interface {
+	Precedes(other interface{}) bool;
+};
+
+// Chooser is the type of the functions used to decide which of the instances
+// of an item found in the sources is emitted when duplicates are being
+// removed.  The instances are given in the order of their sources (and in
+// order of iteration for duplicates within a source).
+type Chooser func(instances []Item) Item;
+
+// First chooses the instance from the first source containing the item.
+func First(instances []Item) Item {
+	return instances[0];
+};
+
+// Last chooses the instance from the last source containing the item.
+func Last(instances []Item) Item {
+	return instances[len(instances) - 1];
+};
+
+// The next item from a source.
+type cursor struct {
+	item Item;
+	source int;
+	next func() (Item, bool);
+};
+
+// A heap of cursors ordered by item and then by source.
+type cursors struct {
+	cursors []*cursor;
+	less func(a, b Item) bool;
+};
+
+func (this *cursors) Len() int {
+	return len(this.cursors);
+};
+
+func (this *cursors) Less(i, j int) bool {
+	a, b := this.cursors[i], this.cursors[j];
+	if this.less(a.item, b.item) {
+		return true;
+	} else if this.less(b.item, a.item) {
+		return false;
+	};
+	return a.source < b.source;
+};
+
+func (this *cursors) Swap(i, j int) {
+	this.cursors[i], this.cursors[j] = this.cursors[j], this.cursors[i];
+};
+
+func (this *cursors) Push(x interface{}) {
+	this.cursors = append(this.cursors, x.(*cursor));
+};
+
+func (this *cursors) Pop() interface{} {
+	last := len(this.cursors) - 1;
+	c := this.cursors[last];
+	this.cursors = this.cursors[0:last];
+	return c;
+};
+
+// Remove the first cursor from the heap and return its item putting the
+// cursor back if its source has more items.
+func (this *cursors) take() Item {
+	c := heap.Pop(this).(*cursor);
+	item := c.item;
+	if next, ok := c.next(); ok {
+		c.item = next;
+		heap.Push(this, c);
+	};
+	return item;
+};
+
+func merge(less func(a, b Item) bool, choose Chooser, sources []func() (Item, bool), out chan<- Item) {
+	h := &cursors{less: less};
+	for i, next := range sources {
+		if item, ok := next(); ok {
+			h.cursors = append(h.cursors, &cursor{item, i, next});
+		};
+	};
+	heap.Init(h);
+	for h.Len() > 0 {
+		item := h.take();
+		if choose != nil {
+			instances := []Item{item};
+			for h.Len() > 0 && !less(item, h.cursors[0].item) {
+				instances = append(instances, h.take());
+			};
+			item = choose(instances);
+		};
+		out <- item;
+	};
+	close(out);
+};
+
+// Trees returns a channel that will emit the items in trees in order.  If
+// choose is nil every instance of every item is emitted (with equal items in
+// the order of their trees) otherwise each item is emitted once as chosen by
+// choose.  The trees must not be modified while the iteration is in progress.
+func Trees(choose Chooser, trees ...*llrb_tree.Tree) <-chan Item {
+	sources := make([]func() (Item, bool), len(trees));
+	for i, tree := range trees {
+		c := tree.Iter(llrb_tree.IN_ORDER);
+		sources[i] = func() (Item, bool) {
+			item, ok := <-c;
+			return item, ok;
+		};
+	};
+	out := make(chan Item);
+	go merge(func(a, b Item) bool { return a.Precedes(b); }, choose, sources, out);
+	return out;
+};
+
+// Sets returns a channel that will emit the members of sets in the order that
+// sets hold them (see heteroset.Compare()).  choose is used as by Trees().
+// The sets must not be modified while the iteration is in progress.
+func Sets(choose Chooser, sets ...*heteroset.Set) <-chan Item {
+	sources := make([]func() (Item, bool), len(sets));
+	for i, set := range sets {
+		c := set.Iter();
+		sources[i] = func() (Item, bool) {
+			item, ok := <-c;
+			return item, ok;
+		};
+	};
+	out := make(chan Item);
+	go merge(func(a, b Item) bool { return heteroset.Compare(a, b) < 0; }, choose, sources, out);
+	return out;
+};
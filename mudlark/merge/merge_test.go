@@ -0,0 +1,94 @@
+// Copyright 2010 -- Peter Williams, all rights reserved
+// Use of this source code is governed by the new BSD license.
+
+package merge;
+
+import (
+	"testing";
+	"fmt";
+	"mudlark/set/heteroset";
+	"mudlark/tree/llrb_tree";
+);
+
+type Int int;
+
+func (i Int) Precedes(other interface{}) bool {
+	return int(i) < int(other.(Int));
+};
+
+type Real float64;
+
+func (r Real) Precedes(other interface{}) bool {
+	return float64(r) < float64(other.(Real));
+};
+
+type key_value struct {
+	key int;
+	value string;
+};
+
+func (this key_value) Precedes(other interface{}) bool {
+	return this.key < other.(key_value).key;
+};
+
+func make_tree(filtered bool, items ...llrb_tree.Item) (tree *llrb_tree.Tree) {
+	tree = llrb_tree.Make(filtered);
+	for _, item := range items {
+		tree.Insert(item);
+	};
+	return;
+};
+
+func collect(c <-chan Item) string {
+	var items []Item;
+	for item := range c {
+		items = append(items, item);
+	};
+	return fmt.Sprint(items);
+};
+
+func check(t *testing.T, what, expected, got string) {
+	if expected != got {
+		t.Errorf("%v: expected %v got %v", what, expected, got);
+	};
+};
+
+func TestTrees(t *testing.T) {
+	a := make_tree(false, Int(1), Int(4), Int(4), Int(7));
+	b := make_tree(true, Int(2), Int(4), Int(9));
+	c := make_tree(true);
+	check(t, "all", "[1 2 4 4 4 7 9]", collect(Trees(nil, a, b, c)));
+	check(t, "deduplicated", "[1 2 4 7 9]", collect(Trees(First, a, b, c)));
+	check(t, "none", "[]", collect(Trees(nil)));
+	check(t, "unchanged", "[1 4 4 7]", collect(Trees(nil, a)));
+};
+
+func TestTreesChoose(t *testing.T) {
+	a := make_tree(true, key_value{1, "a1"}, key_value{2, "a2"});
+	b := make_tree(true, key_value{2, "b2"}, key_value{3, "b3"});
+	c := make_tree(true, key_value{2, "c2"});
+	check(t, "all", "[{1 a1} {2 a2} {2 b2} {2 c2} {3 b3}]", collect(Trees(nil, a, b, c)));
+	check(t, "first", "[{1 a1} {2 a2} {3 b3}]", collect(Trees(First, a, b, c)));
+	check(t, "last", "[{1 a1} {2 c2} {3 b3}]", collect(Trees(Last, a, b, c)));
+	count := func(instances []Item) Item {
+		return key_value{instances[0].(key_value).key, fmt.Sprint(len(instances))};
+	};
+	check(t, "count", "[{1 1} {2 3} {3 1}]", collect(Trees(count, a, b, c)));
+};
+
+func TestSets(t *testing.T) {
+	a := heteroset.New(Int(1), Int(3), Real(2.5));
+	b := heteroset.New(Int(2), Int(3), Real(0.5));
+	var expected []Item;
+	for item := range heteroset.Union(a, b).Iter() {
+		expected = append(expected, item);
+	};
+	check(t, "union", fmt.Sprint(expected), collect(Sets(First, a, b)));
+	n := 0;
+	for _ = range Sets(nil, a, b) {
+		n++;
+	};
+	if n != 6 {
+		t.Errorf("Expected 6 items: got %v", n);
+	};
+};
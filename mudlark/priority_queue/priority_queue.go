@@ -0,0 +1,134 @@
+// Copyright 2010 -- Peter Williams, all rights reserved
+// Use of this source code is governed by the new BSD license.
+
+// The priority_queue package implements priority queues whose elements'
+// priorities can be changed (or the elements removed) after they have been
+// queued.  The elements are kept in a left leaning red black tree (see
+// mudlark/tree/llrb_tree) ordered by priority and each is identified by a
+// Handle so that all operations are O(log N).
+package priority_queue;
+
+import "mudlark/tree/llrb_tree";
+
+// Handle identifies an element of a Queue.  Handles are never reused by the
+// same Queue.
+type Handle uint64;
+
+type element struct {
+	handle Handle;
+	value interface{};
+	priority llrb_tree.Item;
+};
+
+// Elements are ordered by priority and then by when they were given it so that
+// elements of equal priority are dequeued in the order that they were pushed
+// (or last had their priorities updated).
+type by_priority struct {
+	*element;
+	// the order in which the element was given its priority
+	seq uint64;
+};
+
+func (this by_priority) Precedes(other interface{}) bool {
+	that := other.(by_priority);
+	if this.priority.Precedes(that.priority) {
+		return true;
+	} else if that.priority.Precedes(this.priority) {
+		return false;
+	};
+	return this.seq < that.seq;
+};
+
+// Queue is a priority queue in which the element with the lowest priority
+// (as defined by Item.Precedes()) is at the front.  Instances of Queue must be
+// created using Make().
+type Queue struct {
+	tree *llrb_tree.Tree;
+	elements map[Handle]by_priority;
+	last_handle Handle;
+	last_seq uint64;
+};
+
+// Make an empty Queue.
+func Make() (queue *Queue) {
+	queue = new(Queue);
+	queue.tree = llrb_tree.Make(true);
+	queue.elements = make(map[Handle]by_priority);
+	return;
+};
+
+func (this *Queue) add(e *element) {
+	this.last_seq++;
+	item := by_priority{e, this.last_seq};
+	this.elements[e.handle] = item;
+	this.tree.Insert(item);
+};
+
+// Push value onto the queue with the given priority.  The returned handle can
+// be used to update the priority of the element or remove it.
+func (this *Queue) Push(value interface{}, priority llrb_tree.Item) (handle Handle) {
+	this.last_handle++;
+	handle = this.last_handle;
+	this.add(&element{handle, value, priority});
+	return;
+};
+
+// Peek returns the element at the front of the queue without removing it.
+// found is false if the queue is empty.
+func (this *Queue) Peek() (value interface{}, priority llrb_tree.Item, found bool) {
+	item, found := this.tree.Min();
+	if found {
+		value, priority = item.(by_priority).value, item.(by_priority).priority;
+	};
+	return;
+};
+
+// Pop removes the element at the front of the queue and returns it.  found is
+// false if the queue is empty.
+func (this *Queue) Pop() (value interface{}, priority llrb_tree.Item, found bool) {
+	item, found := this.tree.DeleteMin();
+	if found {
+		e := item.(by_priority).element;
+		this.elements[e.handle] = by_priority{}, false;
+		value, priority = e.value, e.priority;
+	};
+	return;
+};
+
+// Get returns the element identified by handle.  found is false if it is no
+// longer in the queue.
+func (this *Queue) Get(handle Handle) (value interface{}, priority llrb_tree.Item, found bool) {
+	item, found := this.elements[handle];
+	if found {
+		value, priority = item.value, item.priority;
+	};
+	return;
+};
+
+// Update changes the priority of the element identified by handle.  found is
+// false (and the queue is unchanged) if it is no longer in the queue.
+func (this *Queue) Update(handle Handle, priority llrb_tree.Item) (found bool) {
+	item, found := this.elements[handle];
+	if found {
+		this.tree.Delete(item);
+		item.priority = priority;
+		this.add(item.element);
+	};
+	return;
+};
+
+// Remove the element identified by handle from the queue.  found is false if
+// it is no longer in the queue.
+func (this *Queue) Remove(handle Handle) (found bool) {
+	item, found := this.elements[handle];
+	if found {
+		this.tree.Delete(item);
+		this.elements[handle] = by_priority{}, false;
+	};
+	return;
+};
+
+// Len returns the number of elements in the queue.
+func (this *Queue) Len() uint {
+	return this.tree.Len();
+};
@@ -0,0 +1,90 @@
+// Copyright 2010 -- Peter Williams, all rights reserved
+// Use of this source code is governed by the new BSD license.
+
+package priority_queue;
+
+import (
+	"testing";
+	"rand";
+);
+
+type Int int;
+
+func (i Int) Precedes(other interface{}) bool {
+	return int(i) < int(other.(Int));
+};
+
+func TestPushPop(t *testing.T) {
+	queue := Make();
+	if _, _, found := queue.Pop(); found {
+		t.Errorf("Popped from empty queue");
+	};
+	queue.Push("c", Int(3));
+	queue.Push("a", Int(1));
+	queue.Push("b1", Int(2));
+	queue.Push("b2", Int(2));
+	if v, p, found := queue.Peek(); !found || v != "a" || p != Int(1) {
+		t.Errorf("Peek: expected a 1: got %v %v %v", v, p, found);
+	};
+	for _, expected := range []string{"a", "b1", "b2", "c"} {
+		if v, _, found := queue.Pop(); !found || v != expected {
+			t.Errorf("Pop: expected %v: got %v", expected, v);
+		};
+	};
+	if queue.Len() != 0 {
+		t.Errorf("Expected empty queue: got %v elements", queue.Len());
+	};
+};
+
+func TestUpdateRemove(t *testing.T) {
+	queue := Make();
+	a := queue.Push("a", Int(1));
+	b := queue.Push("b", Int(2));
+	c := queue.Push("c", Int(3));
+	if !queue.Update(c, Int(0)) {
+		t.Errorf("Update failed");
+	};
+	if v, p, _ := queue.Get(c); v != "c" || p != Int(0) {
+		t.Errorf("Get: expected c 0: got %v %v", v, p);
+	};
+	if !queue.Remove(a) || queue.Remove(a) {
+		t.Errorf("Remove returned wrong result");
+	};
+	if queue.Update(a, Int(5)) {
+		t.Errorf("Updated removed element");
+	};
+	if v, _, _ := queue.Pop(); v != "c" {
+		t.Errorf("Pop: expected c: got %v", v);
+	};
+	if v, _, _ := queue.Pop(); v != "b" {
+		t.Errorf("Pop: expected b: got %v", v);
+	};
+	if _, _, found := queue.Get(b); found {
+		t.Errorf("Found popped element");
+	};
+};
+
+// Decrease keys at random and check that elements come out in order.
+func TestRandom(t *testing.T) {
+	queue := Make();
+	priorities := make(map[Handle]int);
+	for i := 0; i < 1000; i++ {
+		p := rand.Intn(1000);
+		priorities[queue.Push(i, Int(p))] = p;
+	};
+	for h, p := range priorities {
+		if rand.Intn(2) == 0 {
+			p -= rand.Intn(500);
+			queue.Update(h, Int(p));
+			priorities[h] = p;
+		};
+	};
+	last := -1 << 30;
+	for queue.Len() > 0 {
+		_, p, _ := queue.Pop();
+		if int(p.(Int)) < last {
+			t.Errorf("Popped %v after %v", p, last);
+		};
+		last = int(p.(Int));
+	};
+};
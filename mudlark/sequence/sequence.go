@@ -0,0 +1,419 @@
+// Copyright 2010 -- Peter Williams, all rights reserved
+// Use of this source code is governed by the new BSD license.
+
+// The sequence package implements sequences of values (a.k.a. ropes) that
+// support insertion, deletion, splitting and concatenation at any position in
+// O(log N) time.  They are left leaning red black trees (see
+// mudlark/tree/llrb_tree) whose nodes record the size of their subtrees so
+// that the position of a value is implied by the structure of the tree
+// rather than by a key.
+package sequence;
+
+import (
+	"os";
+	"sync";
+);
+
+// ErrRange is the panic value used when a position is out of range.
+var ErrRange = os.NewError("sequence: position out of range");
+
+type node struct {
+	value interface{};
+	left, right *node;
+	red bool;
+	// the number of values in the subtree rooted at this node
+	size uint;
+	// the generation of the sequence that owns (and may modify) this node
+	gen uint;
+};
+
+func is_red(node *node) bool { return node != nil && node.red; };
+
+func size(node *node) uint {
+	if node == nil {
+		return 0;
+	};
+	return node.size;
+};
+
+func resize(node *node) {
+	node.size = size(node.left) + size(node.right) + 1;
+};
+
+// As with llrb_tree's transactions, Slice() and Concat() share nodes between
+// sequences and only the sequence whose generation matches a node's may
+// modify that node in place.
+var generations struct {
+	sync.Mutex;
+	last uint;
+};
+
+func new_generation() (gen uint) {
+	generations.Lock();
+	generations.last++;
+	gen = generations.last;
+	generations.Unlock();
+	return;
+};
+
+// Sequence is a sequence of values indexed from 0.  The zero value is an
+// empty sequence ready to use.
+type Sequence struct {
+	root *node;
+	gen uint;
+};
+
+// Make a Sequence containing values.
+func Make(values ...interface{}) (sequence *Sequence) {
+	sequence = new(Sequence);
+	for _, value := range values {
+		sequence.InsertAt(sequence.Len(), value);
+	};
+	return;
+};
+
+func (this *Sequence) new_node(value interface{}) *node {
+	return &node{value: value, red: true, size: 1, gen: this.gen};
+};
+
+func (this *Sequence) own(n *node) *node {
+	if n.gen == this.gen {
+		return n;
+	};
+	clone := new(node);
+	*clone = *n;
+	clone.gen = this.gen;
+	return clone;
+};
+
+func (this *Sequence) flip_colours(node *node) {
+	node.red = !node.red;
+	node.left = this.own(node.left);
+	node.left.red = !node.left.red;
+	node.right = this.own(node.right);
+	node.right.red = !node.right.red;
+};
+
+func (this *Sequence) rotate_left(node *node) *node {
+	tmp := this.own(node.right);
+	node.right = tmp.left;
+	tmp.left = node;
+	tmp.red = node.red;
+	node.red = true;
+	resize(node);
+	resize(tmp);
+	return tmp;
+};
+
+func (this *Sequence) rotate_right(node *node) *node {
+	tmp := this.own(node.left);
+	node.left = tmp.right;
+	tmp.right = node;
+	tmp.red = node.red;
+	node.red = true;
+	resize(node);
+	resize(tmp);
+	return tmp;
+};
+
+func (this *Sequence) fix_up(node *node) *node {
+	if is_red(node.right) && !is_red(node.left) {
+		node = this.rotate_left(node);
+	};
+	if is_red(node.left) && is_red(node.left.left) {
+		node = this.rotate_right(node);
+	};
+	if is_red(node.left) && is_red(node.right) {
+		this.flip_colours(node);
+	};
+	resize(node);
+	return node;
+};
+
+func (this *Sequence) insert(node *node, i uint, value interface{}) *node {
+	if node == nil {
+		return this.new_node(value);
+	};
+	node = this.own(node);
+	if left := size(node.left); i <= left {
+		node.left = this.insert(node.left, i, value);
+	} else {
+		node.right = this.insert(node.right, i - left - 1, value);
+	};
+	return this.fix_up(node);
+};
+
+func (this *Sequence) move_red_left(node *node) *node {
+	this.flip_colours(node);
+	if is_red(node.right.left) {
+		node.right = this.rotate_right(node.right);
+		node = this.rotate_left(node);
+		this.flip_colours(node);
+	};
+	return node;
+};
+
+func (this *Sequence) move_red_right(node *node) *node {
+	this.flip_colours(node);
+	if is_red(node.left.left) {
+		node = this.rotate_right(node);
+		this.flip_colours(node);
+	};
+	return node;
+};
+
+func (this *Sequence) delete_left_most(node *node) *node {
+	if node.left == nil {
+		return nil;
+	};
+	node = this.own(node);
+	if !is_red(node.left) && !is_red(node.left.left) {
+		node = this.move_red_left(node);
+	};
+	node.left = this.delete_left_most(node.left);
+	return this.fix_up(node);
+};
+
+// Sedgewick's deletion with positions in place of keys.  Rotations don't
+// change the order of the values in a subtree so i remains valid for
+// whichever node ends up at the root of it.
+func (this *Sequence) delete(node *node, i uint) (*node, interface{}) {
+	var deleted interface{};
+	node = this.own(node);
+	if i < size(node.left) {
+		if !is_red(node.left) && !is_red(node.left.left) {
+			node = this.move_red_left(node);
+		};
+		node.left, deleted = this.delete(node.left, i);
+	} else {
+		if is_red(node.left) {
+			node = this.rotate_right(node);
+		};
+		if i == size(node.left) && node.right == nil {
+			return nil, node.value;
+		};
+		if !is_red(node.right) && !is_red(node.right.left) {
+			node = this.move_red_right(node);
+		};
+		if i == size(node.left) {
+			left_most := node.right;
+			for left_most.left != nil {
+				left_most = left_most.left;
+			};
+			deleted = node.value;
+			node.value = left_most.value;
+			node.right = this.delete_left_most(node.right);
+		} else {
+			node.right, deleted = this.delete(node.right, i - size(node.left) - 1);
+		};
+	};
+	return this.fix_up(node), deleted;
+};
+
+// The black height of a subtree (not counting its root if it is red).
+func black_height(node *node) (h int) {
+	for ; node != nil; node = node.left {
+		if !node.red {
+			h++;
+		};
+	};
+	return;
+};
+
+// The black height of node's children given that of node.
+func child_height(node *node, h int) int {
+	if node.red {
+		return h;
+	};
+	return h - 1;
+};
+
+// Join the subtrees left and right (with black roots and black heights hl and
+// hr where hl >= hr) with mid between them.  mid is attached (as a red node)
+// to the right spine of left at the point where the black heights match and
+// the tree is then repaired on the way back up exactly as after an insertion.
+func (this *Sequence) join_right(left *node, hl int, mid, right *node, hr int) *node {
+	if hl == hr && !is_red(left) {
+		mid.left, mid.right, mid.red = left, right, true;
+		resize(mid);
+		return mid;
+	};
+	left = this.own(left);
+	left.right = this.join_right(left.right, child_height(left, hl), mid, right, hr);
+	return this.fix_up(left);
+};
+
+// The mirror image of join_right() for hl < hr.
+func (this *Sequence) join_left(left *node, hl int, mid, right *node, hr int) *node {
+	if hl == hr && !is_red(right) {
+		mid.left, mid.right, mid.red = left, right, true;
+		resize(mid);
+		return mid;
+	};
+	right = this.own(right);
+	right.left = this.join_left(left, hl, mid, right.left, child_height(right, hr));
+	return this.fix_up(right);
+};
+
+// Join left, mid (which must be owned by this sequence) and right into a
+// single tree with a black root and return it with its black height.
+func (this *Sequence) join(left *node, hl int, mid, right *node, hr int) (root *node, h int) {
+	if hl >= hr {
+		root, h = this.join_right(left, hl, mid, right, hr), hl;
+	} else {
+		root, h = this.join_left(left, hl, mid, right, hr), hr;
+	};
+	if root.red {
+		root.red = false;
+		h++;
+	};
+	return;
+};
+
+// Split the subtree (with black height h) into those values before position i
+// and the rest.  Each level of the tree joins one subtree onto one of the
+// halves and the cost of each join is proportional to the difference in the
+// heights of the joined trees so the total cost is O(log N).
+func (this *Sequence) split(n *node, h int, i uint) (left *node, hl int, right *node, hr int) {
+	if n == nil {
+		return;
+	};
+	n = this.own(n);
+	ch := child_height(n, h);
+	l, lh := n.left, ch;
+	if is_red(l) {
+		l = this.own(l);
+		l.red = false;
+		lh++;
+	};
+	if i <= size(l) {
+		var r *node;
+		var rh int;
+		left, hl, r, rh = this.split(l, lh, i);
+		right, hr = this.join(r, rh, n, n.right, ch);
+	} else {
+		var r *node;
+		var rh int;
+		r, rh, right, hr = this.split(n.right, ch, i - size(l) - 1);
+		left, hl = this.join(l, lh, n, r, rh);
+	};
+	return;
+};
+
+// Len returns the number of values in the sequence.
+func (this *Sequence) Len() uint {
+	return size(this.root);
+};
+
+// At returns the value at position i.
+func (this *Sequence) At(i uint) interface{} {
+	if i >= this.Len() {
+		panic(ErrRange);
+	};
+	node := this.root;
+	for {
+		if left := size(node.left); i < left {
+			node = node.left;
+		} else if i > left {
+			i -= left + 1;
+			node = node.right;
+		} else {
+			return node.value;
+		};
+	};
+	return nil;
+};
+
+// InsertAt inserts value at position i (which may be Len() to append it)
+// moving the values from i onwards up one position.
+func (this *Sequence) InsertAt(i uint, value interface{}) {
+	if i > this.Len() {
+		panic(ErrRange);
+	};
+	this.root = this.insert(this.root, i, value);
+	this.root.red = false;
+};
+
+// DeleteAt deletes the value at position i and returns it moving the values
+// after it down one position.
+func (this *Sequence) DeleteAt(i uint) (value interface{}) {
+	if i >= this.Len() {
+		panic(ErrRange);
+	};
+	this.root, value = this.delete(this.root, i);
+	if this.root != nil {
+		this.root.red = false;
+	};
+	return;
+};
+
+// Split removes the values from position i onwards from the sequence and
+// returns them as a new sequence.
+func (this *Sequence) Split(i uint) (tail *Sequence) {
+	if i > this.Len() {
+		panic(ErrRange);
+	};
+	tail = new(Sequence);
+	// The two halves have no nodes in common.
+	tail.gen = this.gen;
+	this.root, _, tail.root, _ = this.split(this.root, black_height(this.root), i);
+	return;
+};
+
+// Concat appends the values in other to this sequence.  other is unchanged
+// and the two sequences share their nodes until either is modified.
+func (this *Sequence) Concat(other *Sequence) {
+	if other.root == nil {
+		return;
+	};
+	// All of the nodes in both sequences will be shared (even if other
+	// is this sequence).
+	this.gen = new_generation();
+	other.gen = new_generation();
+	if this.root == nil {
+		this.root = other.root;
+		return;
+	};
+	left, right := this.root, other.root;
+	mid := this.new_node(this.At(this.Len() - 1));
+	left, _ = this.delete(left, size(left) - 1);
+	if left != nil {
+		left.red = false;
+	};
+	this.root, _ = this.join(left, black_height(left), mid, right, black_height(right));
+};
+
+// Slice returns a new sequence containing the values from position i up to
+// (but not including) position j.  The sequence is unchanged and the two
+// sequences share their nodes until either is modified.
+func (this *Sequence) Slice(i, j uint) (slice *Sequence) {
+	if i > j || j > this.Len() {
+		panic(ErrRange);
+	};
+	slice = new(Sequence);
+	slice.root = this.root;
+	slice.gen = new_generation();
+	this.gen = new_generation();
+	slice.Split(j);
+	return slice.Split(i);
+};
+
+func iterate(node *node, c chan<- interface{}) {
+	if node == nil {
+		return;
+	};
+	iterate(node.left, c);
+	c <- node.value;
+	iterate(node.right, c);
+};
+
+// Iterate over the values in the sequence in order.  The sequence must not be
+// modified while the iteration is in progress.
+func (this *Sequence) Iter() <-chan interface{} {
+	c := make(chan interface{});
+	go func() {
+		iterate(this.root, c);
+		close(c);
+	}();
+	return c;
+};
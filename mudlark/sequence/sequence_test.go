@@ -0,0 +1,199 @@
+// Copyright 2010 -- Peter Williams, all rights reserved
+// Use of this source code is governed by the new BSD license.
+
+package sequence;
+
+import (
+	"testing";
+	"rand";
+	"fmt";
+);
+
+// Check the red black invariants and the subtree sizes returning the black
+// height of the subtree.
+func check_node(t *testing.T, node *node) int {
+	if node == nil {
+		return 0;
+	};
+	if is_red(node.right) {
+		t.Errorf("Red right link at %v", node.value);
+	};
+	if is_red(node) && is_red(node.left) {
+		t.Errorf("Consecutive red links at %v", node.value);
+	};
+	if node.size != size(node.left) + size(node.right) + 1 {
+		t.Errorf("Wrong size at %v", node.value);
+	};
+	hl, hr := check_node(t, node.left), check_node(t, node.right);
+	if hl != hr {
+		t.Errorf("Unbalanced at %v: %v != %v", node.value, hl, hr);
+	};
+	if !node.red {
+		hl++;
+	};
+	return hl;
+};
+
+func check(t *testing.T, what string, sequence *Sequence, expected []int) {
+	if is_red(sequence.root) {
+		t.Errorf("%v: red root", what);
+	};
+	if h := check_node(t, sequence.root); h != black_height(sequence.root) {
+		t.Errorf("%v: black height %v but %v on the left spine", what, h, black_height(sequence.root));
+	};
+	var values []int;
+	for v := range sequence.Iter() {
+		values = append(values, v.(int));
+	};
+	if fmt.Sprint(values) != fmt.Sprint(expected) || sequence.Len() != uint(len(expected)) {
+		t.Errorf("%v: expected %v got %v", what, expected, values);
+	};
+	for i, v := range expected {
+		if sequence.At(uint(i)).(int) != v {
+			t.Errorf("%v: At(%v) expected %v got %v", what, i, v, sequence.At(uint(i)));
+		};
+	};
+};
+
+func make_ints(n int) (sequence *Sequence, values []int) {
+	sequence = new(Sequence);
+	for i := 0; i < n; i++ {
+		sequence.InsertAt(uint(i), i);
+		values = append(values, i);
+	};
+	return;
+};
+
+func concat(a, b []int) []int {
+	return append(append([]int(nil), a...), b...);
+};
+
+func TestInsertDeleteAt(t *testing.T) {
+	sequence := Make();
+	var values []int;
+	for i := 0; i < 2000; i++ {
+		if len(values) > 0 && rand.Intn(3) == 0 {
+			p := rand.Intn(len(values));
+			if v := sequence.DeleteAt(uint(p)); v.(int) != values[p] {
+				t.Errorf("DeleteAt(%v): expected %v got %v", p, values[p], v);
+			};
+			values = concat(values[0:p], values[p + 1:]);
+		} else {
+			p := rand.Intn(len(values) + 1);
+			sequence.InsertAt(uint(p), i);
+			values = concat(values[0:p], concat([]int{i}, values[p:]));
+		};
+	};
+	check(t, "random", sequence, values);
+};
+
+func TestSplitConcat(t *testing.T) {
+	for n := 0; n < 40; n++ {
+		for i := 0; i <= n; i++ {
+			sequence, values := make_ints(n);
+			tail := sequence.Split(uint(i));
+			check(t, fmt.Sprintf("head %v/%v", i, n), sequence, values[0:i]);
+			check(t, fmt.Sprintf("tail %v/%v", i, n), tail, values[i:]);
+			sequence.Concat(tail);
+			check(t, fmt.Sprintf("concat %v/%v", i, n), sequence, values);
+		};
+	};
+};
+
+func TestConcatSizes(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		a, av := make_ints(rand.Intn(300));
+		b, bv := make_ints(rand.Intn(300));
+		a.Concat(b);
+		check(t, "concat", a, concat(av, bv));
+		check(t, "concatenated", b, bv);
+	};
+	a, av := make_ints(50);
+	a.Concat(a);
+	check(t, "self concat", a, concat(av, av));
+};
+
+func TestSlice(t *testing.T) {
+	sequence, values := make_ints(200);
+	for n := 0; n < 100; n++ {
+		i := rand.Intn(len(values) + 1);
+		j := i + rand.Intn(len(values) + 1 - i);
+		slice := sequence.Slice(uint(i), uint(j));
+		check(t, fmt.Sprintf("slice [%v:%v]", i, j), slice, values[i:j]);
+		// modifying either must not affect the other
+		slice.InsertAt(0, -1);
+		if j > i {
+			slice.DeleteAt(slice.Len() - 1);
+		};
+		sequence.InsertAt(uint(i), -2);
+		sequence.DeleteAt(uint(i));
+		check(t, "sliced", sequence, values);
+	};
+};
+
+// Random operations on a few sequences (which share nodes after Concat() and
+// Slice()) checking the invariants of every sequence after each one.
+func TestRandomOperations(t *testing.T) {
+	const n = 4;
+	sequences := make([]*Sequence, n);
+	values := make([][]int, n);
+	for i := range sequences {
+		sequences[i], values[i] = make_ints(rand.Intn(100));
+	};
+	next := 1000;
+	for step := 0; step < 1000; step++ {
+		a, b := rand.Intn(n), rand.Intn(n);
+		sequence, vs := sequences[a], values[a];
+		var what string;
+		switch op := rand.Intn(10); {
+		case op < 4:
+			p := rand.Intn(len(vs) + 1);
+			what = fmt.Sprintf("InsertAt(%v)", p);
+			sequence.InsertAt(uint(p), next);
+			values[a] = concat(vs[0:p], concat([]int{next}, vs[p:]));
+			next++;
+		case op < 7 && len(vs) > 0:
+			p := rand.Intn(len(vs));
+			what = fmt.Sprintf("DeleteAt(%v)", p);
+			if v := sequence.DeleteAt(uint(p)); v.(int) != vs[p] {
+				t.Errorf("DeleteAt(%v): expected %v got %v", p, vs[p], v);
+			};
+			values[a] = concat(vs[0:p], vs[p + 1:]);
+		case op < 8:
+			p := rand.Intn(len(vs) + 1);
+			what = fmt.Sprintf("Split(%v)", p);
+			if a != b {
+				sequences[b] = sequence.Split(uint(p));
+				values[a], values[b] = vs[0:p], vs[p:];
+			};
+		case op < 9 && len(vs) + len(values[b]) < 1000:
+			what = fmt.Sprintf("Concat(%v)", b);
+			sequence.Concat(sequences[b]);
+			values[a] = concat(vs, values[b]);
+		default:
+			i := rand.Intn(len(vs) + 1);
+			j := i + rand.Intn(len(vs) + 1 - i);
+			what = fmt.Sprintf("Slice(%v, %v)", i, j);
+			if a != b {
+				sequences[b] = sequence.Slice(uint(i), uint(j));
+				values[b] = concat(nil, vs[i:j]);
+			};
+		};
+		for i, sequence := range sequences {
+			check(t, fmt.Sprintf("step %v %v: sequence %v", step, what, i), sequence, values[i]);
+		};
+		if t.Failed() {
+			break;
+		};
+	};
+};
+
+func TestRange(t *testing.T) {
+	sequence, _ := make_ints(3);
+	defer func() {
+		if recover() != ErrRange {
+			t.Errorf("Expected ErrRange panic");
+		};
+	}();
+	sequence.At(3);
+};
@@ -10,9 +10,19 @@
 // The principal difference (other than the conversion to Go) is that the items
 // being inserted combine the roles of both key and value and the items
 // being inserted do not have to be of the same type.)
+//
+// The sets' trees have the same shape as those of the llrb_tree package and
+// so their Stats() (and instrumentation Metrics) are reported with that
+// package's types.  This lets the same code (or the same Metrics) be used to
+// examine either kind of tree.  The nodes themselves can't be shared as the
+// sets' items are ordered by type as well as by Precedes().
 package heteroset;
 
-import "reflect";
+import (
+	"reflect";
+	"sync/atomic";
+	"mudlark/tree/llrb_tree";
+);
 
 // The type of potential set items must implement this interface and must
 // satisfy the following formal requirements (where a, b and c are all
@@ -31,12 +41,18 @@ type ll_rb_node struct {
 	item Item;
 	left, right *ll_rb_node;
 	red bool;
+	// the hash of the subtree rooted at this node (see NewHashed())
+	hash uint64;
+	// the number of nodes in the subtree rooted at this node
+	size uint;
 };
 
-func new_ll_rb_node(item Item) *ll_rb_node {
+func (this *Set) new_ll_rb_node(item Item) *ll_rb_node {
 	node := new(ll_rb_node);
 	node.item = item;
 	node.red = true;
+	resize(node);
+	this.rehash(node);
 	return node;
 };
 
@@ -65,152 +81,213 @@ func cmp_type(a, b interface{}) int {
 	return cmp_string(ta.Name(), tb.Name());
 };
 
-func (this *ll_rb_node) compare_item(item Item) int {
-	if ct := cmp_type(this.item, item); ct != 0 {
+// Compare returns a negative number, zero or a positive number depending on
+// whether a comes before, is equal to or comes after b in the order in which
+// sets hold their members (i.e. by type and then by Item.Precedes()).
+func Compare(a, b Item) int {
+	if ct := cmp_type(a, b); ct != 0 {
 		return ct;
 	};
-	if this.item.Precedes(item) {
+	if a.Precedes(b) {
 		return -1;
-	} else if item.Precedes(this.item) {
+	} else if b.Precedes(a) {
 		return 1;
 	};
 	return 0;
 };
 
+func (this *ll_rb_node) compare_item(item Item) int {
+	return Compare(this.item, item);
+};
+
 func is_red(node *ll_rb_node) bool { return node != nil && node.red; };
 
-func flip_colours(node *ll_rb_node) {
+func size_of(node *ll_rb_node) uint {
+	if node == nil {
+		return 0;
+	};
+	return node.size;
+};
+
+func resize(node *ll_rb_node) {
+	node.size = size_of(node.left) + size_of(node.right) + 1;
+};
+
+func (this *Set) flip_colours(node *ll_rb_node) {
+	if this.metrics != nil {
+		atomic.AddUint64(&this.metrics.FlipColours, 1);
+	};
 	node.red = !node.red;
 	node.left.red = !node.left.red;
 	node.right.red = !node.right.red;
 };
 
-func rotate_left(node *ll_rb_node) *ll_rb_node {
+func (this *Set) rotate_left(node *ll_rb_node) *ll_rb_node {
+	if this.metrics != nil {
+		atomic.AddUint64(&this.metrics.RotateLefts, 1);
+	};
 	tmp := node.right;
 	node.right = tmp.left;
 	tmp.left = node;
 	tmp.red = node.red;
 	node.red = true;
+	resize(node);
+	this.rehash(node);
+	resize(tmp);
+	this.rehash(tmp);
 	return tmp;
 };
 
-func rotate_right(node *ll_rb_node) *ll_rb_node {
+func (this *Set) rotate_right(node *ll_rb_node) *ll_rb_node {
+	if this.metrics != nil {
+		atomic.AddUint64(&this.metrics.RotateRights, 1);
+	};
 	tmp := node.left;
 	node.left = tmp.right;
 	tmp.right = node;
 	tmp.red = node.red;
 	node.red = true;
+	resize(node);
+	this.rehash(node);
+	resize(tmp);
+	this.rehash(tmp);
 	return tmp;
 };
 
-func fix_up(node *ll_rb_node) *ll_rb_node {
+func (this *Set) fix_up(node *ll_rb_node) *ll_rb_node {
 	if is_red(node.right) && !is_red(node.left) {
-		node = rotate_left(node);
+		node = this.rotate_left(node);
 	};
 	if is_red(node.left) && is_red(node.left.left) {
-		node = rotate_right(node);
+		node = this.rotate_right(node);
 	};
 	if is_red(node.left) && is_red(node.right) {
-		flip_colours(node);
+		this.flip_colours(node);
 	};
+	resize(node);
+	this.rehash(node);
 	return node;
 };
 
-func insert(node *ll_rb_node, item Item) (*ll_rb_node, bool) {
+// Returns the overwritten item (or nil if item was added to the set).
+func (this *Set) insert(node *ll_rb_node, item Item) (*ll_rb_node, Item) {
 	if node == nil {
-		return new_ll_rb_node(item), true;
+		return this.new_ll_rb_node(item), nil;
 	};
-	inserted := false;
-	switch cmp := node.compare_item(item); {
+	var old Item;
+	switch cmp := this.compare(node, item); {
 	case cmp > 0:
-		node.left, inserted = insert(node.left, item);
+		node.left, old = this.insert(node.left, item);
 	case cmp < 0:
-		node.right, inserted = insert(node.right, item);
+		node.right, old = this.insert(node.right, item);
 	default:
 		// overwrite the existing equivalent item so that Sets are useful
 		// with (key, value) items
+		old = node.item;
 		node.item = item;
 	};
-	return fix_up(node), inserted;
+	return this.fix_up(node), old;
 };
 
-func move_red_left(node *ll_rb_node) *ll_rb_node {
-	flip_colours(node);
+func (this *Set) move_red_left(node *ll_rb_node) *ll_rb_node {
+	if this.metrics != nil {
+		atomic.AddUint64(&this.metrics.MoveRedLefts, 1);
+	};
+	this.flip_colours(node);
 	if (is_red(node.right.left)) {
-		node.right = rotate_right(node.right);
-		node = rotate_left(node);
-		flip_colours(node);
+		node.right = this.rotate_right(node.right);
+		node = this.rotate_left(node);
+		this.flip_colours(node);
 	};
 	return node;
 };
 
-func move_red_right(node *ll_rb_node) *ll_rb_node {
-	flip_colours(node);
+func (this *Set) move_red_right(node *ll_rb_node) *ll_rb_node {
+	if this.metrics != nil {
+		atomic.AddUint64(&this.metrics.MoveRedRights, 1);
+	};
+	this.flip_colours(node);
 	if (is_red(node.left.left)) {
-		node = rotate_right(node);
-		flip_colours(node);
+		node = this.rotate_right(node);
+		this.flip_colours(node);
 	};
 	return node;
 };
 
-func delete_left_most(node *ll_rb_node) *ll_rb_node {
+func (this *Set) delete_left_most(node *ll_rb_node) *ll_rb_node {
 	if node.left == nil {
 		return nil;
 	};
 	if !is_red(node.left) && !is_red(node.left.left) {
-		node = move_red_left(node);
+		node = this.move_red_left(node);
 	};
-	node.left = delete_left_most(node.left);
-	return fix_up(node);
+	node.left = this.delete_left_most(node.left);
+	return this.fix_up(node);
 };
 
-func delete(node *ll_rb_node, item Item) (*ll_rb_node, bool) {
-	var deleted bool;
-	if node.compare_item(item) > 0 {
+// Unlike Sedgewick's original this copes with item not being in the set.
+// Returns the deleted instance (or nil if item wasn't found).
+func (this *Set) delete(node *ll_rb_node, item Item) (*ll_rb_node, Item) {
+	if node == nil {
+		return nil, nil;
+	};
+	var deleted Item;
+	if this.compare(node, item) > 0 {
+		if node.left == nil {
+			return node, nil;
+		};
 		if !is_red(node.left) && !is_red(node.left.left) {
-			node = move_red_left(node);
+			node = this.move_red_left(node);
 		};
-		node.left, deleted = delete(node.left, item);
+		node.left, deleted = this.delete(node.left, item);
 	} else {
 		if is_red(node.left) {
-			node = rotate_right(node);
+			node = this.rotate_right(node);
 		};
-		if node.compare_item(item) == 0 && node.right == nil {
-			return nil, true;
+		if this.compare(node, item) == 0 && node.right == nil {
+			return nil, node.item;
 		};
-		if !is_red(node.right) && !is_red(node.right.left) {
-			node = move_red_right(node);
+		if node.right != nil && !is_red(node.right) && !is_red(node.right.left) {
+			node = this.move_red_right(node);
 		};
-		if node.compare_item(item) == 0 {
+		if this.compare(node, item) == 0 {
 			left_most := node.right;
 			for left_most.left != nil {
 				left_most = left_most.left;
 			};
+			deleted = node.item;
 			node.item = left_most.item;
-			node.right = delete_left_most(node.right);
-			deleted = true;
+			node.right = this.delete_left_most(node.right);
 		} else {
-			node.right, deleted = delete(node.right, item);
+			node.right, deleted = this.delete(node.right, item);
 		};
 	};
-	return fix_up(node), deleted;
+	return this.fix_up(node), deleted;
 };
 
 // Iteration using recursion is safe because the depth of the tree should never
 // be greater than 2Log2(N) where N is the number of nodes in the tree and
 // (in general) will be approximately Log2(N).
 
-func iterate_inorder(node *ll_rb_node, c chan<- Item) {
+// Returns false if the iteration was abandoned because done was closed (a nil
+// done is never closed).
+func iterate_inorder(node *ll_rb_node, c chan<- Item, done <-chan struct{}) bool {
 	if node == nil {
-		return;
+		return true;
 	}
-	iterate_inorder(node.left, c);
-	c <- node.item;
-	iterate_inorder(node.right, c);
+	if !iterate_inorder(node.left, c, done) {
+		return false;
+	};
+	select {
+	case c <- node.item:
+	case <-done:
+		return false;
+	};
+	return iterate_inorder(node.right, c, done);
 };
 
-func iterate(node *ll_rb_node, c chan<- Item) {
-	iterate_inorder(node, c);
+func iterate(node *ll_rb_node, c chan<- Item, done <-chan struct{}) {
+	iterate_inorder(node, c, done);
 	close(c);
 };
 
@@ -219,6 +296,8 @@ func copy(node *ll_rb_node) *ll_rb_node {
 	clone := new(ll_rb_node);
 	clone.item = node.item;
 	clone.red = node.red;
+	clone.hash = node.hash;
+	clone.size = node.size;
 	clone.left = copy(node.left);
 	clone.right = copy(node.right);
 	return clone;
@@ -231,6 +310,12 @@ func copy(node *ll_rb_node) *ll_rb_node {
 type Set struct {
 	root *ll_rb_node;
 	count uint;
+	// nil unless the set was made by NewHashed()
+	hasher HashFunc;
+	observers []registration;
+	last_observer_id uint;
+	// nil unless the set is instrumented (see Instrument())
+	metrics *llrb_tree.Metrics;
 };
 
 // Make a Set. The optional Item parameters will be used to initialize the set's
@@ -251,6 +336,7 @@ func (this *Set) Cardinality() uint {
 // Make a copy of this set.
 func (this *Set) Copy() (set *Set) {
 	set = new(Set);
+	set.hasher = this.hasher;
 	set.root = copy(this.root);
 	set.count = this.count;
 	return;
@@ -261,11 +347,14 @@ func (this *Set) Copy() (set *Set) {
 // structure and only the key is used for implementing Precedes() for using
 // a Set as a look up table.
 func (this *Set) Find(item Item) (instance Item, found bool) {
+	if this.metrics != nil {
+		atomic.AddUint64(&this.metrics.Finds, 1);
+	};
 	if this.count == 0 {
 		return;
 	};
 	for node := this.root; node != nil && !found; {
-		switch cmp := node.compare_item(item); {
+		switch cmp := this.compare(node, item); {
 		case cmp > 0:
 			node = node.left;
 		case cmp < 0:
@@ -290,28 +379,60 @@ func (this *Set) Has(item Item) (has bool) {
 // structure and only the key is used for implementing Precedes() for use as a
 // look up table.
 func (this *Set) Add(item Item) {
-	var inserted bool;
-	this.root, inserted = insert(this.root, item);
-	if inserted {
+	if this.metrics != nil {
+		atomic.AddUint64(&this.metrics.Inserts, 1);
+	};
+	var old Item;
+	this.root, old = this.insert(this.root, item);
+	if old == nil {
 		this.count++;
 	};
 	this.root.red = false;
+	this.notify(old, item);
 };
 
-// Remove item from the set.
+// Remove item from the set.  Removing an item that is not a member has no
+// effect.
 func (this *Set) Remove(item Item) {
-	var deleted bool;
-	this.root, deleted = delete(this.root, item);
-	if deleted {
+	if this.metrics != nil {
+		atomic.AddUint64(&this.metrics.Deletes, 1);
+	};
+	var deleted Item;
+	this.root, deleted = this.delete(this.root, item);
+	if this.root != nil {
+		this.root.red = false;
+	};
+	if deleted != nil {
 		this.count--;
+		this.notify(deleted, nil);
 	};
-	this.root.red = false;
 };
 
 // Iterate over the set members in arbitrary type order and in order within type.
 func (this *Set) Iter() <-chan Item {
 	c := make(chan Item);
-	go iterate(this.root, c);
+	go iterate(this.root, c, nil);
+	return c;
+};
+
+// Canceller is implemented by anything that signals that an operation should
+// be abandoned by closing the channel returned by Done() (e.g. a
+// context.Context).
+type Canceller interface {
+	Done() <-chan struct{};
+};
+
+// IterContext is the same as Iter() except that the iteration is abandoned
+// (and the channel closed) as soon as ctx is cancelled so that the iterating
+// goroutine doesn't wait forever for a consumer that has gone away.  A nil
+// ctx is never cancelled.
+func (this *Set) IterContext(ctx Canceller) <-chan Item {
+	var done <-chan struct{};
+	if ctx != nil {
+		done = ctx.Done();
+	};
+	c := make(chan Item);
+	go iterate(this.root, c, done);
 	return c;
 };
 
@@ -320,7 +441,7 @@ func (this *Set) Iter() <-chan Item {
 // recommended for use when circumstances preclude the use of Iter().
 func (this *Set) IterAsync() <-chan Item {
 	c := make(chan Item, this.count);
-	iterate(this.root, c);
+	iterate(this.root, c, nil);
 	return c;
 };
 
@@ -390,6 +511,8 @@ func ProperSuperset(setA, setB *Set) bool {
 
 // Equal returns true if setA and setB contain exactly the same members
 //	Intersection(setA, setB) == setA == setB
+// Only Item.Precedes() is consulted and the members are always examined: see
+// HashEqual() for an O(1) test for sets made by NewHashed().
 func Equal(setA, setB *Set) bool {
 	if setA.Cardinality() != setB.Cardinality() { return false; };
 	return Subset(setA, setB);
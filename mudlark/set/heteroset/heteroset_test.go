@@ -304,3 +304,38 @@ func TestIntersection(t *testing.T) {
 	};
 };
 
+
+type canceller chan struct{};
+
+func (this canceller) Done() <-chan struct{} {
+	return this;
+};
+
+func TestIterContext(t *testing.T) {
+	set := New();
+	for i := 0; i < 1000; i++ {
+		set.Add(Int(i));
+		set.Add(Real(i));
+	};
+	n := 0;
+	for _ = range set.IterContext(nil) {
+		n++;
+	};
+	if n != 2000 {
+		t.Errorf("Expected 2000 items: got %v", n);
+	};
+	ctx := make(canceller);
+	c := set.IterContext(ctx);
+	for i := 0; i < 10; i++ {
+		<-c;
+	};
+	close(ctx);
+	// The channel must be closed after at most one more item.
+	n = 0;
+	for _ = range c {
+		n++;
+	};
+	if n > 1 {
+		t.Errorf("Iteration continued for %v items after cancellation", n);
+	};
+};
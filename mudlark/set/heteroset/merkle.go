@@ -0,0 +1,143 @@
+// Copyright 2010 -- Peter Williams, all rights reserved
+// Use of this source code is governed by the new BSD license.
+
+package heteroset;
+
+// HashFunc is the type of the functions used to hash the members of sets made
+// by NewHashed().  Items that are equal (as defined by Item.Precedes()) but
+// differ in other respects (e.g. {key, value} items with different values)
+// should have different hashes.
+type HashFunc func(item Item) uint64;
+
+// Make a Set in which each node caches a hash of its subtree so that sets can
+// be compared (see HashEqual()) and their differences found (see
+// Differences()) without examining all of their members.  The optional Item
+// parameters will be used to initialize the set's contents.
+//
+// The hash of a subtree is the sum of the hashes of its members so that
+// (unlike the shape of the tree) it does not depend on the order in which
+// the members were added.
+func NewHashed(hasher HashFunc, items ...Item) (set *Set) {
+	set = new(Set);
+	set.hasher = hasher;
+	for _, item := range items {
+		set.Add(item);
+	};
+	return;
+};
+
+func hash_of(node *ll_rb_node) uint64 {
+	if node == nil {
+		return 0;
+	};
+	return node.hash;
+};
+
+func (this *Set) rehash(node *ll_rb_node) {
+	if this.hasher != nil {
+		node.hash = this.hasher(node.item) + hash_of(node.left) + hash_of(node.right);
+	};
+};
+
+// HashEqual returns true if setA and setB have the same number of members and
+// the same hash which (as it takes O(1) time) is a cheap test for whether
+// they are probably equal.  A match only means "probably" because different
+// memberships can have the same hash.  A mismatch means that the members
+// differ although perhaps only in ways that Item.Precedes() ignores (so that
+// Equal() may still be true).  Both sets must have been made by NewHashed()
+// with the same hash function: as functions can't be compared that is up to
+// the caller.  It is false if either set isn't hashed.
+func HashEqual(setA, setB *Set) bool {
+	if setA.hasher == nil || setB.hasher == nil {
+		return false;
+	};
+	return setA.Cardinality() == setB.Cardinality() && setA.Hash() == setB.Hash();
+};
+
+// Hash returns the hash of the set's members.  It is always 0 for sets not
+// made by NewHashed().
+func (this *Set) Hash() uint64 {
+	return hash_of(this.root);
+};
+
+// The sum of the hashes of the members that precede bound (or that do not
+// follow it if inclusive).
+func prefix_hash(node *ll_rb_node, bound Item, inclusive bool) (hash uint64) {
+	for node != nil {
+		cmp := node.compare_item(bound);
+		if cmp < 0 || (inclusive && cmp == 0) {
+			hash += node.hash - hash_of(node.right);
+			node = node.right;
+		} else {
+			node = node.left;
+		};
+	};
+	return;
+};
+
+// The sum of the hashes of the members that follow lo and precede hi where
+// nil means unbounded.
+func range_hash(node *ll_rb_node, lo, hi Item) (hash uint64) {
+	if hi == nil {
+		hash = hash_of(node);
+	} else {
+		hash = prefix_hash(node, hi, false);
+	};
+	if lo != nil {
+		hash -= prefix_hash(node, lo, true);
+	};
+	return;
+};
+
+// The member closest to the root that follows lo and precedes hi.
+func pivot(node *ll_rb_node, lo, hi Item) Item {
+	for node != nil {
+		if lo != nil && node.compare_item(lo) <= 0 {
+			node = node.right;
+		} else if hi != nil && node.compare_item(hi) >= 0 {
+			node = node.left;
+		} else {
+			return node.item;
+		};
+	};
+	return nil;
+};
+
+// Mismatch describes a member that differs between two sets.  A and B are
+// the instances of the member in each set with nil meaning that the set
+// doesn't contain the member.
+type Mismatch struct {
+	A, B Item;
+};
+
+func differences(setA, setB *Set, lo, hi Item, c chan<- Mismatch) {
+	if range_hash(setA.root, lo, hi) == range_hash(setB.root, lo, hi) {
+		return;
+	};
+	p := pivot(setA.root, lo, hi);
+	if p == nil {
+		p = pivot(setB.root, lo, hi);
+	};
+	differences(setA, setB, lo, p, c);
+	var d Mismatch;
+	d.A, _ = setA.Find(p);
+	d.B, _ = setB.Find(p);
+	if d.A == nil || d.B == nil || setA.hasher(d.A) != setB.hasher(d.B) {
+		c <- d;
+	};
+	differences(setA, setB, p, hi, c);
+};
+
+// Differences returns a channel that will emit (in the same order as Iter())
+// each member that differs between setA and setB.  Both sets must have been
+// made by NewHashed() with the same hash function and only those ranges of
+// members whose hashes differ are examined so the cost is proportional to the
+// number of differences rather than to the size of the sets.
+func Differences(setA, setB *Set) <-chan Mismatch {
+	c := make(chan Mismatch);
+	go func() {
+		differences(setA, setB, nil, nil, c);
+		close(c);
+	}();
+	return c;
+};
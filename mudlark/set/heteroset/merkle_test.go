@@ -0,0 +1,117 @@
+// Copyright 2010 -- Peter Williams, all rights reserved
+// Use of this source code is governed by the new BSD license.
+
+package heteroset;
+
+import (
+	"testing";
+	"rand";
+	"math";
+);
+
+func hash_item(item Item) uint64 {
+	var h uint64;
+	switch i := item.(type) {
+	case Int:
+		h = uint64(i);
+	case Real:
+		h = math.Float64bits(float64(i)) ^ 0x9e3779b97f4a7c15;
+	};
+	// finalizer from MurmurHash3
+	h ^= h >> 33;
+	h *= 0xff51afd7ed558ccd;
+	h ^= h >> 33;
+	h *= 0xc4ceb93fe53e88b3;
+	h ^= h >> 33;
+	return h;
+};
+
+// Check that every node's cached hash is correct.
+func check_hashes(t *testing.T, node *ll_rb_node) uint64 {
+	if node == nil {
+		return 0;
+	};
+	hash := hash_item(node.item) + check_hashes(t, node.left) + check_hashes(t, node.right);
+	if hash != node.hash {
+		t.Errorf("Bad hash at %v: %v != %v", node.item, node.hash, hash);
+	};
+	return hash;
+};
+
+func TestHashShapeIndependent(t *testing.T) {
+	forward, backward := NewHashed(hash_item), NewHashed(hash_item);
+	for i := 0; i < 1000; i++ {
+		forward.Add(Int(i));
+		forward.Add(Real(i));
+		backward.Add(Real(999 - i));
+		backward.Add(Int(999 - i));
+	};
+	if forward.Hash() != backward.Hash() || !Equal(forward, backward) {
+		t.Errorf("Equal sets not equal: %v != %v", forward.Hash(), backward.Hash());
+	};
+	forward.Remove(Int(500));
+	backward.Remove(Real(500));
+	if forward.Hash() == backward.Hash() || Equal(forward, backward) {
+		t.Errorf("Unequal sets equal");
+	};
+	check_hashes(t, forward.root);
+	check_hashes(t, backward.root);
+	if copy := forward.Copy(); copy.Hash() != forward.Hash() || !Equal(copy, forward) {
+		t.Errorf("Copy not equal");
+	};
+};
+
+func hash_identity(item Item) uint64 {
+	return uint64(item.(Int));
+};
+
+func TestHashEqual(t *testing.T) {
+	setA, setB := NewHashed(hash_identity, Int(1), Int(4)), NewHashed(hash_identity, Int(2), Int(3));
+	// a collision: the hashes only say that the sets are probably equal
+	if !HashEqual(setA, setB) || Equal(setA, setB) {
+		t.Errorf("Colliding sets: HashEqual() %v, Equal() %v", HashEqual(setA, setB), Equal(setA, setB));
+	};
+	// whether a set is hashed makes no difference to Equal()
+	setB = NewHashed(hash_identity, Int(4), Int(1));
+	unhashed := New(Int(1), Int(4));
+	if !HashEqual(setA, setB) || !Equal(setA, unhashed) || !Equal(unhashed, setB) || HashEqual(setA, unhashed) {
+		t.Errorf("Equal() depends on hashing");
+	};
+	setB.Add(Int(5));
+	if HashEqual(setA, setB) || Equal(setA, setB) {
+		t.Errorf("Unequal sets equal");
+	};
+};
+
+func TestDifferences(t *testing.T) {
+	setA, setB := NewHashed(hash_item), NewHashed(hash_item);
+	for i := 0; i < 500; i++ {
+		n := rand.Intn(1000);
+		setA.Add(Int(n));
+		setB.Add(Int(n));
+		setA.Add(Real(n));
+		setB.Add(Real(n));
+	};
+	if _, ok := <-Differences(setA, setB); ok {
+		t.Errorf("Equal sets have differences");
+	};
+	for i := 0; i < 20; i++ {
+		setA.Add(Int(rand.Intn(1000)));
+		setB.Add(Real(rand.Intn(1000)));
+	};
+	expected := SymmetricDifference(setA, setB);
+	count := uint(0);
+	for d := range Differences(setA, setB) {
+		count++;
+		item := d.A;
+		if item == nil {
+			item = d.B;
+		};
+		if !expected.Has(item) {
+			t.Errorf("Unexpected difference %v", item);
+		};
+	};
+	if count != expected.Cardinality() {
+		t.Errorf("Expected %v differences: got %v", expected.Cardinality(), count);
+	};
+};
@@ -0,0 +1,38 @@
+// Copyright 2010 -- Peter Williams, all rights reserved
+// Use of this source code is governed by the new BSD license.
+
+package heteroset;
+
+import (
+	"sync/atomic";
+	"mudlark/tree/llrb_tree";
+);
+
+// Instrument makes the set count its operations in metrics (which may be
+// shared by several sets and trees).  Add(), Remove() and Find() (and Has())
+// are counted as inserts, deletes and finds and members of different types
+// are ordered without counting a comparison.  A nil metrics turns
+// instrumentation off.  Sets that aren't instrumented don't incur the cost of
+// counting.
+func (this *Set) Instrument(metrics *llrb_tree.Metrics) {
+	this.metrics = metrics;
+};
+
+// The same as node.compare_item(item) but counting calls to Precedes().
+func (this *Set) compare(node *ll_rb_node, item Item) int {
+	if this.metrics == nil {
+		return node.compare_item(item);
+	};
+	if ct := cmp_type(node.item, item); ct != 0 {
+		return ct;
+	};
+	atomic.AddUint64(&this.metrics.Comparisons, 1);
+	if node.item.Precedes(item) {
+		return -1;
+	};
+	atomic.AddUint64(&this.metrics.Comparisons, 1);
+	if item.Precedes(node.item) {
+		return 1;
+	};
+	return 0;
+};
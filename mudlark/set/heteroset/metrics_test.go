@@ -0,0 +1,61 @@
+// Copyright 2010 -- Peter Williams, all rights reserved
+// Use of this source code is governed by the new BSD license.
+
+package heteroset;
+
+import (
+	"testing";
+	"rand";
+	"mudlark/tree/llrb_tree";
+);
+
+type counted_int struct {
+	value int;
+	count *uint64;
+};
+
+func (this counted_int) Precedes(other interface{}) bool {
+	*this.count++;
+	return this.value < other.(counted_int).value;
+};
+
+func TestMetrics(t *testing.T) {
+	var metrics llrb_tree.Metrics;
+	var comparisons uint64;
+	set := New();
+	set.Instrument(&metrics);
+	for i := 0; i < 1000; i++ {
+		set.Add(counted_int{rand.Intn(500), &comparisons});
+		set.Add(Int(i));
+	};
+	for i := 0; i < 100; i++ {
+		set.Remove(counted_int{rand.Intn(500), &comparisons});
+		set.Has(counted_int{rand.Intn(500), &comparisons});
+	};
+	if metrics.Inserts != 2000 || metrics.Deletes != 100 || metrics.Finds != 100 || metrics.Operations() != 2200 {
+		t.Errorf("Wrong operation counts: %v", metrics.String());
+	};
+	if metrics.Comparisons <= comparisons {
+		t.Errorf("Expected more than %v comparisons: got %v", comparisons, metrics.Comparisons);
+	};
+	if metrics.RotateLefts == 0 || metrics.RotateRights == 0 || metrics.FlipColours == 0 || metrics.MoveRedLefts == 0 || metrics.MoveRedRights == 0 {
+		t.Errorf("Expected structural changes: %v", metrics.String());
+	};
+	set.Instrument(nil);
+	before := metrics;
+	set.Add(Int(-1));
+	if metrics != before {
+		t.Errorf("Uninstrumented set updated metrics");
+	};
+	// the same metrics can count the operations of sets and trees
+	metrics.Reset();
+	tree := llrb_tree.Make(true);
+	tree.Instrument(&metrics);
+	set.Instrument(&metrics);
+	tree.Insert(Int(1));
+	set.Add(Int(1));
+	tree.Find(Int(1));
+	if metrics.Inserts != 2 || metrics.Finds != 1 {
+		t.Errorf("Wrong shared operation counts: %v", metrics.String());
+	};
+};
@@ -0,0 +1,61 @@
+// Copyright 2010 -- Peter Williams, all rights reserved
+// Use of this source code is governed by the new BSD license.
+
+package heteroset;
+
+import "testing";
+
+type event struct {
+	old, new Item;
+};
+
+type event_log struct {
+	events []event;
+};
+
+func (this *event_log) Inserted(item Item) {
+	this.events = append(this.events, event{nil, item});
+};
+
+func (this *event_log) Overwritten(old, new Item) {
+	this.events = append(this.events, event{old, new});
+};
+
+func (this *event_log) Deleted(item Item) {
+	this.events = append(this.events, event{item, nil});
+};
+
+func (this *event_log) check(t *testing.T, expected ...event) {
+	if len(this.events) != len(expected) {
+		t.Errorf("Expected %v events: got %v", expected, this.events);
+		return;
+	};
+	for i, e := range expected {
+		if this.events[i] != e {
+			t.Errorf("Event %v: expected %v got %v", i, e, this.events[i]);
+		};
+	};
+	this.events = nil;
+};
+
+func TestObservers(t *testing.T) {
+	set := New(Int(1));
+	logA, logB := new(event_log), new(event_log);
+	idA := set.AddObserver(logA);
+	set.AddObserver(logB);
+	set.Add(Int(2));
+	set.Add(Real(2));
+	set.Add(Int(2));
+	set.Remove(Int(1));
+	set.Remove(Int(3));
+	expected := []event{event{nil, Int(2)}, event{nil, Real(2)}, event{Int(2), Int(2)}, event{Int(1), nil}};
+	logA.check(t, expected...);
+	logB.check(t, expected...);
+	set.RemoveObserver(idA);
+	set.Remove(Real(2));
+	logA.check(t);
+	logB.check(t, event{Real(2), nil});
+	if set.Copy().Add(Int(5)); len(logB.events) != 0 {
+		t.Errorf("Copy shares observers");
+	};
+};
@@ -0,0 +1,90 @@
+// Copyright 2010 -- Peter Williams, all rights reserved
+// Use of this source code is governed by the new BSD license.
+
+package heteroset;
+
+import (
+	"testing";
+	"rand";
+);
+
+func check_sizes(t *testing.T, node *ll_rb_node) uint {
+	if node == nil {
+		return 0;
+	};
+	size := check_sizes(t, node.left) + check_sizes(t, node.right) + 1;
+	if size != node.size {
+		t.Errorf("Bad size at %v: %v != %v", node.item, node.size, size);
+	};
+	return size;
+};
+
+func TestSample(t *testing.T) {
+	set := New();
+	rng := rand.New(rand.NewSource(42));
+	if _, found := set.Sample(rng); found {
+		t.Errorf("Sample() of empty set found a member");
+	};
+	for i := 0; i < 2000; i++ {
+		set.Add(Int(rand.Intn(500)));
+		set.Add(Real(rand.Intn(500)));
+	};
+	for i := 0; i < 500; i++ {
+		set.Remove(Int(rand.Intn(500)));
+	};
+	if size := check_sizes(t, set.root); size != set.Cardinality() {
+		t.Errorf("Expected root size %v: got %v", set.Cardinality(), size);
+	};
+	check_sizes(t, set.Copy().root);
+	const samples = 10000;
+	set = New(Int(1), Int(2), Int(3), Real(1), Real(2));
+	counts := make(map[Item]int);
+	for i := 0; i < samples; i++ {
+		item, _ := set.Sample(rng);
+		counts[item]++;
+	};
+	for item := range set.Iter() {
+		if counts[item] < samples / 5 * 8 / 10 || counts[item] > samples / 5 * 12 / 10 {
+			t.Errorf("%v sampled %v times: expected about %v", item, counts[item], samples / 5);
+		};
+	};
+	// the same seed gives the same samples
+	rngA, rngB := rand.New(rand.NewSource(7)), rand.New(rand.NewSource(7));
+	for i := 0; i < 100; i++ {
+		a, _ := set.Sample(rngA);
+		b, _ := set.Sample(rngB);
+		if a != b {
+			t.Errorf("Samples with same seed differ: %v != %v", a, b);
+		};
+	};
+};
+
+func TestSampleK(t *testing.T) {
+	const trials = 4000;
+	set := New(Int(1), Int(2), Int(3), Int(4), Real(1), Real(2), Real(3), Real(4));
+	rng := rand.New(rand.NewSource(42));
+	counts := make(map[Item]int);
+	for i := 0; i < trials; i++ {
+		items := set.SampleK(3, rng);
+		if len(items) != 3 {
+			t.Fatalf("Expected 3 members: got %v", len(items));
+		};
+		seen := New();
+		for _, item := range items {
+			if seen.Has(item) {
+				t.Errorf("%v sampled twice in %v", item, items);
+			};
+			seen.Add(item);
+			counts[item]++;
+		};
+	};
+	expected := trials * 3 / 8;
+	for item := range set.Iter() {
+		if counts[item] < expected * 8 / 10 || counts[item] > expected * 12 / 10 {
+			t.Errorf("%v sampled %v times: expected about %v", item, counts[item], expected);
+		};
+	};
+	if items := set.SampleK(20, rng); len(items) != 8 {
+		t.Errorf("Expected all 8 members: got %v", len(items));
+	};
+};
@@ -0,0 +1,43 @@
+// Copyright 2010 -- Peter Williams, all rights reserved
+// Use of this source code is governed by the new BSD license.
+
+package heteroset;
+
+import (
+	"unsafe";
+	"mudlark/tree/llrb_tree";
+);
+
+func visit(stats *llrb_tree.Stats, node *ll_rb_node, depth uint, total_depth *uint64) {
+	if node == nil {
+		return;
+	};
+	if depth > stats.Height {
+		stats.Height = depth;
+	};
+	if node.red {
+		stats.RedCount++;
+	};
+	*total_depth += uint64(depth);
+	visit(stats, node.left, depth + 1, total_depth);
+	visit(stats, node.right, depth + 1, total_depth);
+};
+
+// Stats examines every node in the set (without modifying it) and returns a
+// description of the shape of its tree (in which the items are the set's
+// members).
+func (this *Set) Stats() (stats llrb_tree.Stats) {
+	stats.Count = this.count;
+	for node := this.root; node != nil; node = node.left {
+		if !node.red {
+			stats.BlackHeight++;
+		};
+	};
+	var total_depth uint64;
+	visit(&stats, this.root, 1, &total_depth);
+	if this.count > 0 {
+		stats.AverageDepth = float64(total_depth) / float64(this.count);
+	};
+	stats.Bytes = uint64(unsafe.Sizeof(*this)) + uint64(this.count) * uint64(unsafe.Sizeof(ll_rb_node{}));
+	return;
+};
@@ -0,0 +1,34 @@
+// Copyright 2010 -- Peter Williams, all rights reserved
+// Use of this source code is governed by the new BSD license.
+
+package heteroset;
+
+import (
+	"testing";
+	"math";
+	"rand";
+);
+
+func TestStats(t *testing.T) {
+	set := New();
+	if stats := set.Stats(); stats.Count != 0 || stats.Height != 0 {
+		t.Errorf("Unexpected stats for empty set: %v", stats);
+	};
+	for i := 0; i < 5000; i++ {
+		set.Add(Int(rand.Int()));
+		set.Add(Real(rand.Float64()));
+	};
+	stats := set.Stats();
+	if stats.Count != set.Cardinality() {
+		t.Errorf("Expected count %v: got %v", set.Cardinality(), stats.Count);
+	};
+	if float64(stats.Height) > 2 * math.Log2(float64(stats.Count + 1)) || stats.AverageDepth > float64(stats.Height) {
+		t.Errorf("Implausible depths: %v", stats);
+	};
+	if stats.BlackHeight > stats.Height || stats.Height > 2 * stats.BlackHeight {
+		t.Errorf("Black height %v inconsistent with height %v", stats.BlackHeight, stats.Height);
+	};
+	if stats.Bytes == 0 {
+		t.Errorf("Expected a size");
+	};
+};
@@ -0,0 +1,384 @@
+// Copyright 2010 -- Peter Williams, all rights reserved
+// Use of this source code is governed by the new BSD license.
+
+package sort;
+
+import (
+	"bufio";
+	"container/heap";
+	"encoding/binary";
+	"io";
+	"io/ioutil";
+	"os";
+	"mudlark/tree/llrb_tree";
+);
+
+// Codec converts items to and from the byte strings written to the temporary
+// files used by External.  Decode(Encode(item)) must return an item equal to
+// item.
+type Codec interface {
+	Encode(item Item) ([]byte, os.Error);
+	Decode(data []byte) (Item, os.Error);
+};
+
+// External sorts channels whose contents are too big to be held in memory.
+// The items are read in runs whose encodings take up (roughly) the memory
+// budget, each run is sorted and written to a temporary file and then the
+// files are merged.  If all of the items fit in a single run no files are
+// written.  No more than the fan-in's worth of files are open at once: if
+// there are more runs than that they are merged in groups (into longer runs)
+// until there aren't.  Instances of External must be created using
+// MakeExternal() and can only be used for one sort at a time.
+type External struct {
+	codec Codec;
+	budget int64;
+	dir string;
+	fan_in int;
+	// the error (if any) that ended the last merge early
+	err os.Error;
+};
+
+// The number of runs merged at once unless SetFanIn() says otherwise.
+const default_fan_in = 64;
+
+// Make an External that uses codec to write items to temporary files in dir
+// (or in the default directory for temporary files if dir is "") and that
+// starts a new run whenever the items read since the last one began take up
+// budget bytes when encoded.  The memory actually used is more than budget by
+// the size of the decoded items.
+func MakeExternal(codec Codec, budget int64, dir string) (external *External) {
+	external = new(External);
+	external.codec = codec;
+	external.budget = budget;
+	external.dir = dir;
+	external.fan_in = default_fan_in;
+	return;
+};
+
+// SetFanIn sets the largest number of runs (and so of open files) that will
+// be merged at once.  It must be at least 2 and is 64 by default.
+func (this *External) SetFanIn(fan_in int) {
+	if fan_in < 2 {
+		fan_in = 2;
+	};
+	this.fan_in = fan_in;
+};
+
+// An item along with its encoding so that it need only be encoded once.
+type encoded struct {
+	item Item;
+	data []byte;
+};
+
+func (this encoded) Precedes(other interface{}) bool {
+	return this.item.Precedes(other.(encoded).item);
+};
+
+// Runs are written as a sequence of records each of which is the length of
+// the item's encoding (4 bytes little endian) followed by the encoding.
+type run_writer struct {
+	file *os.File;
+	writer *bufio.Writer;
+};
+
+func (this *External) create_run() (rw *run_writer, err os.Error) {
+	file, err := ioutil.TempFile(this.dir, "mudlark-sort-");
+	if err != nil {
+		return;
+	};
+	return &run_writer{file, bufio.NewWriter(file)}, nil;
+};
+
+func (this *run_writer) write(item encoded) (err os.Error) {
+	var header [4]byte;
+	binary.LittleEndian.PutUint32(header[0:], uint32(len(item.data)));
+	if _, err = this.writer.Write(header[0:]); err == nil {
+		_, err = this.writer.Write(item.data);
+	};
+	return;
+};
+
+// Finish writing the run and close its file returning the file's name.  If
+// err isn't nil (or finishing fails) the file is removed instead.
+func (this *run_writer) finish(err os.Error) (name string, e os.Error) {
+	if err == nil {
+		err = this.writer.Flush();
+	};
+	if e = this.file.Close(); err == nil {
+		err = e;
+	};
+	if err != nil {
+		os.Remove(this.file.Name());
+		return "", err;
+	};
+	return this.file.Name(), nil;
+};
+
+func (this *External) write_run(run []Item) (name string, err os.Error) {
+	rw, err := this.create_run();
+	if err != nil {
+		return;
+	};
+	for _, item := range run {
+		if err = rw.write(item.(encoded)); err != nil {
+			break;
+		};
+	};
+	return rw.finish(err);
+};
+
+func remove_runs(names []string) {
+	for _, name := range names {
+		os.Remove(name);
+	};
+};
+
+// A run being read back from its file.
+type run_reader struct {
+	file *os.File;
+	reader *bufio.Reader;
+};
+
+func open_run(name string) (rr *run_reader, err os.Error) {
+	file, err := os.Open(name, os.O_RDONLY, 0);
+	if err != nil {
+		return;
+	};
+	return &run_reader{file, bufio.NewReader(file)}, nil;
+};
+
+// Read the next item from the run.  The error is os.EOF at the end of the
+// run.
+func (this *run_reader) next(codec Codec) (item encoded, err os.Error) {
+	var header [4]byte;
+	if _, err = io.ReadFull(this.reader, header[0:]); err != nil {
+		return;
+	};
+	item.data = make([]byte, binary.LittleEndian.Uint32(header[0:]));
+	if _, err = io.ReadFull(this.reader, item.data); err != nil {
+		if err == os.EOF {
+			err = io.ErrUnexpectedEOF;
+		};
+		return;
+	};
+	item.item, err = codec.Decode(item.data);
+	return;
+};
+
+// The next item from a run.  The last run may still be in memory.
+type head struct {
+	item encoded;
+	run int;
+	file *run_reader;
+	memory []Item;
+};
+
+// A heap of heads ordered by item and then by run so that equal items are
+// merged in the order that they were read.
+type heads []*head;
+
+func (this *heads) Len() int {
+	return len(*this);
+};
+
+func (this *heads) Less(i, j int) bool {
+	a, b := (*this)[i], (*this)[j];
+	if a.item.Precedes(b.item) {
+		return true;
+	} else if b.item.Precedes(a.item) {
+		return false;
+	};
+	return a.run < b.run;
+};
+
+func (this *heads) Swap(i, j int) {
+	(*this)[i], (*this)[j] = (*this)[j], (*this)[i];
+};
+
+func (this *heads) Push(x interface{}) {
+	*this = append(*this, x.(*head));
+};
+
+func (this *heads) Pop() interface{} {
+	last := len(*this) - 1;
+	h := (*this)[last];
+	*this = (*this)[0:last];
+	return h;
+};
+
+// Move the head on to the run's next item.  ok is false if the run has been
+// used up.
+func (this *head) advance(codec Codec) (ok bool, err os.Error) {
+	if this.file == nil {
+		if len(this.memory) == 0 {
+			return false, nil;
+		};
+		this.item = this.memory[0].(encoded);
+		this.memory = this.memory[1:];
+		return true, nil;
+	};
+	if this.item, err = this.file.next(codec); err == os.EOF {
+		return false, nil;
+	};
+	return err == nil, err;
+};
+
+// Merge the runs in the named files and then the one in memory (with equal
+// items in that order) passing each item to emit until it returns false.
+// The files are only open while they're being merged.
+func (this *External) merge_runs(names []string, memory []Item, emit func(item encoded) bool) (err os.Error) {
+	h := new(heads);
+	for i := 0; i <= len(names); i++ {
+		next := &head{encoded{}, i, nil, nil};
+		if i < len(names) {
+			if next.file, err = open_run(names[i]); err != nil {
+				break;
+			};
+			defer next.file.file.Close();
+		} else {
+			next.memory = memory;
+		};
+		var ok bool;
+		if ok, err = next.advance(this.codec); err != nil {
+			break;
+		};
+		if ok {
+			heap.Push(h, next);
+		};
+	};
+	for err == nil && h.Len() > 0 {
+		next := heap.Pop(h).(*head);
+		if !emit(next.item) {
+			break;
+		};
+		var ok bool;
+		if ok, err = next.advance(this.codec); ok {
+			heap.Push(h, next);
+		};
+	};
+	return;
+};
+
+// Merge the named runs into a new one returning its name.
+func (this *External) merge_to_file(names []string) (name string, err os.Error) {
+	rw, err := this.create_run();
+	if err != nil {
+		return;
+	};
+	var write_err os.Error;
+	err = this.merge_runs(names, nil, func(item encoded) bool {
+		write_err = rw.write(item);
+		return write_err == nil;
+	});
+	if err == nil {
+		err = write_err;
+	};
+	return rw.finish(err);
+};
+
+// Merge groups of consecutive runs (so that equal items stay in the order
+// that they were read) until there are few enough left (counting the one in
+// memory) to merge at once.  The runs that have been merged are removed and
+// if anything fails all of them are.
+func (this *External) reduce(names []string) ([]string, os.Error) {
+	for len(names) + 1 > this.fan_in {
+		var merged []string;
+		for i := 0; i < len(names); i += this.fan_in {
+			group := names[i:];
+			if len(group) > this.fan_in {
+				group = group[0:this.fan_in];
+			};
+			if len(group) == 1 {
+				merged = append(merged, group[0]);
+				continue;
+			};
+			name, err := this.merge_to_file(group);
+			if err != nil {
+				remove_runs(merged);
+				remove_runs(names[i:]);
+				return nil, err;
+			};
+			remove_runs(group);
+			merged = append(merged, name);
+		};
+		names = merged;
+	};
+	return names, nil;
+};
+
+func (this *External) merge(done <-chan struct{}, names []string, memory []Item, c chan<- Item) {
+	defer close(c);
+	defer remove_runs(names);
+	this.err = this.merge_runs(names, memory, func(item encoded) bool {
+		select {
+		case c <- item.item:
+			return true;
+		case <-done:
+		};
+		return false;
+	});
+};
+
+// SortChan() returns a new <-chan which will emit the contents of channel in
+// order as defined by Item.Precedes() with equal items in the order that they
+// were read (like the package's SortChan()).  The whole of channel is read
+// (and the runs written and, if there are more than the fan-in, merged down
+// to that many) before SortChan() returns.  If that fails the error is
+// returned, the temporary files are removed and the rest of channel is left
+// unread.  An error met while merging the runs closes the returned channel
+// early and is reported by Err().  The temporary files are removed once the
+// returned channel has been closed so it must be read to the end: use
+// SortChanContext() if it might be abandoned.
+func (this *External) SortChan(channel <-chan Item) (sorted <-chan Item, err os.Error) {
+	return this.SortChanContext(nil, channel);
+};
+
+// SortChanContext is the same as SortChan() except that the merge is
+// abandoned (the temporary files removed and the returned channel closed) as
+// soon as ctx is cancelled so that the merging goroutine doesn't wait forever
+// for a consumer that has gone away.  A nil ctx is never cancelled.
+func (this *External) SortChanContext(ctx llrb_tree.Canceller, channel <-chan Item) (sorted <-chan Item, err os.Error) {
+	this.err = nil;
+	var names []string;
+	var run []Item;
+	var size int64;
+	for item := range channel {
+		var data []byte;
+		if data, err = this.codec.Encode(item); err != nil {
+			break;
+		};
+		run = append(run, encoded{item, data});
+		if size += int64(len(data)); size < this.budget {
+			continue;
+		};
+		stable_sort_in_place(run);
+		var name string;
+		if name, err = this.write_run(run); err != nil {
+			break;
+		};
+		names = append(names, name);
+		run, size = nil, 0;
+	};
+	if err == nil {
+		names, err = this.reduce(names);
+	};
+	if err != nil {
+		remove_runs(names);
+		return nil, err;
+	};
+	stable_sort_in_place(run);
+	var done <-chan struct{};
+	if ctx != nil {
+		done = ctx.Done();
+	};
+	c := make(chan Item);
+	go this.merge(done, names, run, c);
+	return c, nil;
+};
+
+// Err returns the error (if any) that stopped the channel returned by the
+// last SortChan() (or SortChanContext()) from emitting all of the items.  It
+// must only be called after that channel has been closed.
+func (this *External) Err() os.Error {
+	return this.err;
+};
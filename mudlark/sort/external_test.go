@@ -0,0 +1,236 @@
+// Copyright 2010 -- Peter Williams, all rights reserved
+// Use of this source code is governed by the new BSD license.
+
+package sort_test;
+
+import (
+	"testing";
+	"encoding/binary";
+	"io/ioutil";
+	"os";
+	"rand";
+	"mudlark/sort";
+);
+
+const test_dir = "_test/external_sort";
+
+// Encodes keyed items as their key and sequence number (8 bytes each).
+type keyed_codec struct {
+	// fail to encode or decode this key
+	bad int;
+};
+
+var errBadKey = os.NewError("bad key");
+
+func (this keyed_codec) Encode(item sort.Item) ([]byte, os.Error) {
+	k := item.(keyed);
+	if k.key == this.bad {
+		return nil, errBadKey;
+	};
+	data := make([]byte, 16);
+	binary.LittleEndian.PutUint64(data[0:8], uint64(k.key));
+	binary.LittleEndian.PutUint64(data[8:16], uint64(k.seq));
+	return data, nil;
+};
+
+func (this keyed_codec) Decode(data []byte) (sort.Item, os.Error) {
+	k := keyed{int(binary.LittleEndian.Uint64(data[0:8])), int(binary.LittleEndian.Uint64(data[8:16]))};
+	if k.key == -this.bad {
+		return nil, errBadKey;
+	};
+	return k, nil;
+};
+
+func keyed_chan(items []sort.Item) <-chan sort.Item {
+	c := make(chan sort.Item, len(items));
+	for _, item := range items {
+		c <- item;
+	};
+	close(c);
+	return c;
+};
+
+func temp_files(t *testing.T) int {
+	files, err := ioutil.ReadDir(test_dir);
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err);
+	};
+	return len(files);
+};
+
+func TestExternalSortChan(t *testing.T) {
+	os.RemoveAll(test_dir);
+	defer os.RemoveAll(test_dir);
+	if err := os.MkdirAll(test_dir, 0777); err != nil {
+		t.Fatalf("MkdirAll: %v", err);
+	};
+	const sz = 10000;
+	items := make([]sort.Item, sz);
+	for i := 0; i < sz; i++ {
+		items[i] = keyed{rand.Intn(sz / 4) + 1, i};
+	};
+	for _, budget := range []int64{16 * 500, 16 * 1000 + 7, 16 * 2 * sz} {
+		external := sort.MakeExternal(keyed_codec{}, budget, test_dir);
+		sorted, err := external.SortChan(keyed_chan(items));
+		if err != nil {
+			t.Fatalf("SortChan: %v", err);
+		};
+		// the last run stays in memory
+		if runs, files := int(16 * sz / budget), temp_files(t); files != runs {
+			t.Errorf("Budget %v: expected %v temporary files: got %v", budget, runs, files);
+		};
+		// equal items must come out in the order that they went in
+		expected := sort.StableSortSlice(items);
+		i := 0;
+		for item := range sorted {
+			if i >= sz || item != expected[i] {
+				t.Errorf("Budget %v: unexpected item at %v: %v", budget, i, item);
+				break;
+			};
+			i++;
+		};
+		if i != sz || external.Err() != nil {
+			t.Errorf("Budget %v: expected %v items: got %v (%v)", budget, sz, i, external.Err());
+		};
+		if files := temp_files(t); files != 0 {
+			t.Errorf("Budget %v: %v temporary files left behind", budget, files);
+		};
+	};
+	external := sort.MakeExternal(keyed_codec{}, 100, test_dir);
+	sorted, err := external.SortChan(keyed_chan(nil));
+	if err != nil {
+		t.Fatalf("SortChan: %v", err);
+	};
+	for item := range sorted {
+		t.Errorf("Unexpected item from empty channel: %v", item);
+	};
+};
+
+func TestExternalSortChanErrors(t *testing.T) {
+	os.RemoveAll(test_dir);
+	defer os.RemoveAll(test_dir);
+	if err := os.MkdirAll(test_dir, 0777); err != nil {
+		t.Fatalf("MkdirAll: %v", err);
+	};
+	items := make([]sort.Item, 1000);
+	for i := range items {
+		items[i] = keyed{len(items) - i, i};
+	};
+	// encoding fails after some runs have been written
+	external := sort.MakeExternal(keyed_codec{100}, 16 * 100, test_dir);
+	if _, err := external.SortChan(keyed_chan(items)); err != errBadKey {
+		t.Errorf("Expected %v: got %v", errBadKey, err);
+	};
+	if files := temp_files(t); files != 0 {
+		t.Errorf("%v temporary files left behind", files);
+	};
+	// decoding fails while merging
+	external = sort.MakeExternal(keyed_codec{-500}, 16 * 100, test_dir);
+	sorted, err := external.SortChan(keyed_chan(items));
+	if err != nil {
+		t.Fatalf("SortChan: %v", err);
+	};
+	n := 0;
+	for _ = range sorted {
+		n++;
+	};
+	if n >= len(items) || external.Err() != errBadKey {
+		t.Errorf("Expected merge to stop with %v: got %v items (%v)", errBadKey, n, external.Err());
+	};
+	if files := temp_files(t); files != 0 {
+		t.Errorf("%v temporary files left behind", files);
+	};
+	// a directory that doesn't exist
+	external = sort.MakeExternal(keyed_codec{}, 16, test_dir + "/missing");
+	if _, err := external.SortChan(keyed_chan(items)); err == nil {
+		t.Errorf("Expected an error using a missing directory");
+	};
+};
+
+func TestExternalFanIn(t *testing.T) {
+	os.RemoveAll(test_dir);
+	defer os.RemoveAll(test_dir);
+	if err := os.MkdirAll(test_dir, 0777); err != nil {
+		t.Fatalf("MkdirAll: %v", err);
+	};
+	const sz = 10000;
+	items := make([]sort.Item, sz);
+	for i := 0; i < sz; i++ {
+		items[i] = keyed{rand.Intn(sz / 4) + 1, i};
+	};
+	expected := sort.StableSortSlice(items);
+	for _, fan_in := range []int{2, 3, 7} {
+		// 100 runs
+		external := sort.MakeExternal(keyed_codec{}, 16 * 100, test_dir);
+		external.SetFanIn(fan_in);
+		sorted, err := external.SortChan(keyed_chan(items));
+		if err != nil {
+			t.Fatalf("SortChan: %v", err);
+		};
+		// the run in memory is merged with the files
+		if files := temp_files(t); files >= fan_in {
+			t.Errorf("Fan-in %v: %v temporary files to merge", fan_in, files);
+		};
+		i := 0;
+		for item := range sorted {
+			if i >= sz || item != expected[i] {
+				t.Errorf("Fan-in %v: unexpected item at %v: %v", fan_in, i, item);
+				break;
+			};
+			i++;
+		};
+		if i != sz || external.Err() != nil {
+			t.Errorf("Fan-in %v: expected %v items: got %v (%v)", fan_in, sz, i, external.Err());
+		};
+		if files := temp_files(t); files != 0 {
+			t.Errorf("Fan-in %v: %v temporary files left behind", fan_in, files);
+		};
+	};
+	// decoding fails while merging runs into longer ones
+	external := sort.MakeExternal(keyed_codec{-500}, 16 * 100, test_dir);
+	external.SetFanIn(4);
+	if _, err := external.SortChan(keyed_chan(items)); err != errBadKey {
+		t.Errorf("Expected %v: got %v", errBadKey, err);
+	};
+	if files := temp_files(t); files != 0 {
+		t.Errorf("%v temporary files left behind", files);
+	};
+};
+
+type canceller chan struct{};
+
+func (this canceller) Done() <-chan struct{} {
+	return this;
+};
+
+func TestExternalSortChanContext(t *testing.T) {
+	os.RemoveAll(test_dir);
+	defer os.RemoveAll(test_dir);
+	if err := os.MkdirAll(test_dir, 0777); err != nil {
+		t.Fatalf("MkdirAll: %v", err);
+	};
+	items := make([]sort.Item, 1000);
+	for i := range items {
+		items[i] = keyed{len(items) - i, i};
+	};
+	ctx := make(canceller);
+	external := sort.MakeExternal(keyed_codec{}, 16 * 100, test_dir);
+	sorted, err := external.SortChanContext(ctx, keyed_chan(items));
+	if err != nil {
+		t.Fatalf("SortChanContext: %v", err);
+	};
+	for i := 0; i < 10; i++ {
+		<-sorted;
+	};
+	close(ctx);
+	n := 10;
+	for _ = range sorted {
+		n++;
+	};
+	if n >= len(items) || external.Err() != nil {
+		t.Errorf("Expected cancelled merge to stop early: got %v items (%v)", n, external.Err());
+	};
+	if files := temp_files(t); files != 0 {
+		t.Errorf("%v temporary files left behind", files);
+	};
+};
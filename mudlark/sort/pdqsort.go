@@ -0,0 +1,303 @@
+// Copyright 2010 -- Peter Williams, all rights reserved
+// Use of this source code is governed by the new BSD license.
+
+package sort;
+
+// Pattern-defeating quicksort (as described by Orson Peters) sorts in place in
+// O(N log N) worst case time:
+// it is a quicksort that recognizes runs that are already (or reverse) sorted,
+// shuffles a few items when partitions become unbalanced to break up
+// adversarial patterns and falls back to heap sort if that doesn't help.
+//
+// The structure of this implementation (the pivot selection, the pattern
+// breaking and the partitioning of runs of equal items) follows that of the
+// Go standard library's sort package, Copyright The Go Authors, which is
+// also distributed under a BSD style license.
+
+// Slices no longer than this are sorted by insertion sort.
+const max_insertion = 12;
+
+// What choose_pivot() learned about the order of the items it looked at.
+type sorted_hint int;
+
+const (
+	unknown_hint sorted_hint = iota;
+	increasing_hint;
+	decreasing_hint;
+);
+
+// A cheap pseudo random number generator for break_patterns().
+type xorshift uint64;
+
+func (this *xorshift) next() uint64 {
+	*this ^= *this << 13;
+	*this ^= *this >> 7;
+	*this ^= *this << 17;
+	return uint64(*this);
+};
+
+// The number of bits needed to represent n.
+func bit_length(n uint) (length uint) {
+	for ; n != 0; n >>= 1 {
+		length++;
+	};
+	return;
+};
+
+func insertion_sort(data []Item, a, b int) {
+	for i := a + 1; i < b; i++ {
+		for j := i; j > a && data[j].Precedes(data[j - 1]); j-- {
+			data[j], data[j - 1] = data[j - 1], data[j];
+		};
+	};
+};
+
+// Restore the heap property below root in the heap held in
+// data[first:first + hi].
+func sift_down(data []Item, root, hi, first int) {
+	for {
+		child := 2 * root + 1;
+		if child >= hi {
+			return;
+		};
+		if child + 1 < hi && data[first + child].Precedes(data[first + child + 1]) {
+			child++;
+		};
+		if !data[first + root].Precedes(data[first + child]) {
+			return;
+		};
+		data[first + root], data[first + child] = data[first + child], data[first + root];
+		root = child;
+	};
+};
+
+func heap_sort(data []Item, a, b int) {
+	first, hi := a, b - a;
+	for i := (hi - 1) / 2; i >= 0; i-- {
+		sift_down(data, i, hi, first);
+	};
+	for i := hi - 1; i >= 0; i-- {
+		data[first], data[first + i] = data[first + i], data[first];
+		sift_down(data, 0, i, first);
+	};
+};
+
+// Sort data[a:b] where limit is the number of unbalanced partitions that
+// will be tolerated before falling back to heap sort.
+func pdqsort(data []Item, a, b int, limit uint) {
+	was_balanced, was_partitioned := true, true;
+	for {
+		length := b - a;
+		if length <= max_insertion {
+			insertion_sort(data, a, b);
+			return;
+		};
+		if limit == 0 {
+			heap_sort(data, a, b);
+			return;
+		};
+		if !was_balanced {
+			break_patterns(data, a, b);
+			limit--;
+		};
+		pivot, hint := choose_pivot(data, a, b);
+		if hint == decreasing_hint {
+			reverse_range(data, a, b);
+			pivot = (b - 1) - (pivot - a);
+			hint = increasing_hint;
+		};
+		// Probably already sorted so try to finish the job cheaply.
+		if was_balanced && was_partitioned && hint == increasing_hint {
+			if partial_insertion_sort(data, a, b) {
+				return;
+			};
+		};
+		// data[a - 1] is the pivot of the partition that this one was part
+		// of so if it's equal to this pivot then so are all of the items
+		// that don't follow this pivot and they need no further sorting.
+		if a > 0 && !data[a - 1].Precedes(data[pivot]) {
+			a = partition_equal(data, a, b, pivot);
+			continue;
+		};
+		mid, already_partitioned := partition(data, a, b, pivot);
+		was_partitioned = already_partitioned;
+		// Recurse into the smaller part and loop on the larger so that the
+		// stack depth is O(log N).
+		left, right := mid - a, b - mid;
+		balance_threshold := length / 8;
+		if left < right {
+			was_balanced = left >= balance_threshold;
+			pdqsort(data, a, mid, limit);
+			a = mid + 1;
+		} else {
+			was_balanced = right >= balance_threshold;
+			pdqsort(data, mid + 1, b, limit);
+			b = mid;
+		};
+	};
+};
+
+// Partition data[a:b] about data[pivot] so that the items that precede it
+// come before it and the rest after it.  Returns the pivot's new position and
+// whether the items were already partitioned.
+func partition(data []Item, a, b, pivot int) (int, bool) {
+	data[a], data[pivot] = data[pivot], data[a];
+	p := data[a];
+	i, j := a + 1, b - 1;
+	for i <= j && data[i].Precedes(p) {
+		i++;
+	};
+	for i <= j && !data[j].Precedes(p) {
+		j--;
+	};
+	if i > j {
+		data[j], data[a] = data[a], data[j];
+		return j, true;
+	};
+	data[i], data[j] = data[j], data[i];
+	i++;
+	j--;
+	for {
+		for i <= j && data[i].Precedes(p) {
+			i++;
+		};
+		for i <= j && !data[j].Precedes(p) {
+			j--;
+		};
+		if i > j {
+			break;
+		};
+		data[i], data[j] = data[j], data[i];
+		i++;
+		j--;
+	};
+	data[j], data[a] = data[a], data[j];
+	return j, false;
+};
+
+// Partition data[a:b] into those items equal to data[pivot] (none of which
+// can precede it) followed by those that follow it.  Returns the position of
+// the first item that follows the pivot.
+func partition_equal(data []Item, a, b, pivot int) int {
+	data[a], data[pivot] = data[pivot], data[a];
+	p := data[a];
+	i, j := a + 1, b - 1;
+	for {
+		for i <= j && !p.Precedes(data[i]) {
+			i++;
+		};
+		for i <= j && p.Precedes(data[j]) {
+			j--;
+		};
+		if i > j {
+			break;
+		};
+		data[i], data[j] = data[j], data[i];
+		i++;
+		j--;
+	};
+	return i;
+};
+
+// Try to sort data[a:b] by moving a few items that are out of place.  Returns
+// false (having done a bounded amount of work) if there are too many.
+func partial_insertion_sort(data []Item, a, b int) bool {
+	const max_steps = 5;
+	const shortest_shifting = 50;
+	i := a + 1;
+	for step := 0; step < max_steps; step++ {
+		for i < b && !data[i].Precedes(data[i - 1]) {
+			i++;
+		};
+		if i == b {
+			return true;
+		};
+		if b - a < shortest_shifting {
+			return false;
+		};
+		data[i], data[i - 1] = data[i - 1], data[i];
+		// shift the smaller item left and the larger one right
+		for j := i - 1; j > a && data[j].Precedes(data[j - 1]); j-- {
+			data[j], data[j - 1] = data[j - 1], data[j];
+		};
+		for j := i + 1; j < b && data[j].Precedes(data[j - 1]); j++ {
+			data[j], data[j - 1] = data[j - 1], data[j];
+		};
+	};
+	return false;
+};
+
+// Swap a few items around the middle of data[a:b] with ones chosen at random
+// to break up patterns that are causing unbalanced partitions.
+func break_patterns(data []Item, a, b int) {
+	length := b - a;
+	if length < 8 {
+		return;
+	};
+	random := xorshift(length);
+	modulus := uint(1) << bit_length(uint(length));
+	idx := a + (length / 4) * 2 - 1;
+	for i := 0; i < 3; i++ {
+		other := int(uint(random.next()) & (modulus - 1));
+		if other >= length {
+			other -= length;
+		};
+		data[idx - 1 + i], data[a + other] = data[a + other], data[idx - 1 + i];
+	};
+};
+
+// Choose a pivot for data[a:b] using the median of three items (or of three
+// medians of three for longer slices).  The number of swaps that sorting
+// those items would have needed hints at the order of the slice.
+func choose_pivot(data []Item, a, b int) (int, sorted_hint) {
+	const shortest_ninther = 50;
+	const max_swaps = 4 * 3;
+	length := b - a;
+	swaps := 0;
+	i, j, k := a + length / 4, a + length / 4 * 2, a + length / 4 * 3;
+	if length >= 8 {
+		if length >= shortest_ninther {
+			i = median_adjacent(data, i, &swaps);
+			j = median_adjacent(data, j, &swaps);
+			k = median_adjacent(data, k, &swaps);
+		};
+		j = median(data, i, j, k, &swaps);
+	};
+	switch swaps {
+	case 0:
+		return j, increasing_hint;
+	case max_swaps:
+		return j, decreasing_hint;
+	};
+	return j, unknown_hint;
+};
+
+func order2(data []Item, a, b int, swaps *int) (int, int) {
+	if data[b].Precedes(data[a]) {
+		*swaps++;
+		return b, a;
+	};
+	return a, b;
+};
+
+func median(data []Item, a, b, c int, swaps *int) int {
+	a, b = order2(data, a, b, swaps);
+	b, c = order2(data, b, c, swaps);
+	a, b = order2(data, a, b, swaps);
+	return b;
+};
+
+func median_adjacent(data []Item, a int, swaps *int) int {
+	return median(data, a - 1, a, a + 1, swaps);
+};
+
+func reverse_range(data []Item, a, b int) {
+	for i, j := a, b - 1; i < j; i, j = i + 1, j - 1 {
+		data[i], data[j] = data[j], data[i];
+	};
+};
+
+// Sort data in place.
+func sort_in_place(data []Item) {
+	pdqsort(data, 0, len(data), bit_length(uint(len(data))));
+};
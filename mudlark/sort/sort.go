@@ -37,9 +37,27 @@ func tree_to_slice(tree *llrb_tree.Tree, order int) (slice []Item) {
 };
 
 // SortSlice() returns a copy of a slice in order as defined by Item.Precedes().
+// The copy is sorted in place using pattern-defeating quicksort (see
+// pdqsort.go) so no other memory is allocated and the order of equal items
+// is not preserved.
 func SortSlice(slice []Item) (sorted []Item) {
-	tree := slice_to_tree(slice, false);
-	return tree_to_slice(tree, llrb_tree.IN_ORDER);
+	sorted = make([]Item, len(slice));
+	copy(sorted, slice);
+	sort_in_place(sorted);
+	return;
+};
+
+// StableSortSlice() returns a copy of a slice in order as defined by
+// Item.Precedes() in which equal items are guaranteed to be in the same order
+// as they were in slice.  It uses Timsort (see timsort.go) which is
+// especially quick when slice is already partially sorted (e.g. consists of
+// sorted runs or is sorted apart from a few items) but uses up to N/2 extra
+// slots of memory.
+func StableSortSlice(slice []Item) (sorted []Item) {
+	sorted = make([]Item, len(slice));
+	copy(sorted, slice);
+	stable_sort_in_place(sorted);
+	return;
 };
 
 // SortFilteredSlice() returns a copy of a slice in order as defined by
@@ -50,10 +68,11 @@ func SortFilteredSlice(slice []Item) (sorted []Item) {
 };
 
 // ReverseSortSlice() returns a copy of a slice in reverse order as defined
-// by Item.Precedes().
+// by Item.Precedes().  See SortSlice().
 func ReverseSortSlice(slice []Item) (sorted []Item) {
-	tree := slice_to_tree(slice, false);
-	return tree_to_slice(tree, llrb_tree.REVERSE_ORDER);
+	sorted = SortSlice(slice);
+	reverse_range(sorted, 0, len(sorted));
+	return;
 };
 
 // ReverseSortFilteredSlice() returns a copy of a slice in reverse order as
@@ -83,7 +102,8 @@ func tree_to_chan(tree *llrb_tree.Tree, order int) (channel chan Item) {
 };
 
 // SortChan() returns a new <-chan which will emit contents of channel
-// in order as defined by Item.Precedes().
+// in order as defined by Item.Precedes().  The whole of channel is held in
+// memory: see External for channels whose contents are too big for that.
 func SortChan(channel <-chan Item) (<-chan Item) {
 	tree := chan_to_tree(channel, false);
 	return tree_to_chan(tree, llrb_tree.IN_ORDER);
@@ -7,6 +7,7 @@ import (
 	"testing";
 	"rand";
 	"mudlark/sort";
+	"mudlark/tree/llrb_tree";
 //	"fmt";
 //	"reflect";
 );
@@ -38,6 +39,121 @@ func (r Real) Precedes(other interface{}) bool {
 	return float64(r) < float64(other.(Real));
 };
 
+// Items that can be equal but still be told apart.
+type keyed struct {
+	key, seq int;
+};
+
+func (this keyed) Precedes(other interface{}) bool {
+	return this.key < other.(keyed).key;
+};
+
+// Inputs with the sorts of order that Timsort takes advantage of.
+func keyed_patterns(sz int) map[string][]sort.Item {
+	p := make(map[string][]sort.Item);
+	for _, name := range []string{"random", "few", "runs", "appended", "descending", "equal"} {
+		p[name] = make([]sort.Item, sz);
+	};
+	for i := 0; i < sz; i++ {
+		p["random"][i] = keyed{rand.Intn(sz / 2 + 1), i};
+		p["few"][i] = keyed{rand.Intn(3), i};
+		p["runs"][i] = keyed{i % 100 + i / 1000, i};
+		if i < sz * 9 / 10 {
+			p["appended"][i] = keyed{i, i};
+		} else {
+			p["appended"][i] = keyed{rand.Intn(sz), i};
+		};
+		p["descending"][i] = keyed{(sz - i) / 3, i};
+		p["equal"][i] = keyed{1, i};
+	};
+	return p;
+};
+
+func TestStableSortSlice(t *testing.T) {
+	for _, sz := range []int{0, 1, 2, 31, 63, 64, 65, 100, 1000, 5000} {
+		for name, slice := range keyed_patterns(sz) {
+			original := make([]sort.Item, sz);
+			copy(original, slice);
+			sorted := sort.StableSortSlice(slice);
+			check_sorted(t, name, original, sorted, false);
+			for i := 1; i < len(sorted); i++ {
+				a, b := sorted[i - 1].(keyed), sorted[i].(keyed);
+				if a.key == b.key && a.seq > b.seq {
+					t.Errorf("%v(%v): unstable at %v: %v : %v", name, sz, i, a, b);
+					break;
+				};
+			};
+			for i := range slice {
+				if slice[i] != original[i] {
+					t.Errorf("%v: argument was modified", name);
+					break;
+				};
+			};
+			// SortChan() is also stable because the tree inserts
+			// equal items after those already present.
+			c := make(chan sort.Item, sz);
+			for _, item := range slice {
+				c <- item;
+			};
+			close(c);
+			i := 0;
+			for item := range sort.SortChan(c) {
+				if item != sorted[i] {
+					t.Errorf("%v(%v): SortChan() differs at %v: %v != %v", name, sz, i, item, sorted[i]);
+					break;
+				};
+				i++;
+			};
+			// SortFilteredSlice() keeps the last of each set of equal
+			// items.
+			var last []sort.Item;
+			for i, item := range sorted {
+				if i + 1 == len(sorted) || item.Precedes(sorted[i + 1]) {
+					last = append(last, item);
+				};
+			};
+			filtered := sort.SortFilteredSlice(slice);
+			if len(filtered) != len(last) {
+				t.Errorf("%v(%v): expected %v filtered items: got %v", name, sz, len(last), len(filtered));
+				continue;
+			};
+			for i := range filtered {
+				if filtered[i] != last[i] {
+					t.Errorf("%v(%v): SortFilteredSlice() differs at %v: %v != %v", name, sz, i, filtered[i], last[i]);
+					break;
+				};
+			};
+		};
+	};
+};
+
+type counted struct {
+	value int;
+	count *int;
+};
+
+func (this counted) Precedes(other interface{}) bool {
+	*this.count++;
+	return this.value < other.(counted).value;
+};
+
+func TestStableSortSliceAdaptive(t *testing.T) {
+	const sz = 10000;
+	var comparisons int;
+	ascending, descending := make([]sort.Item, sz), make([]sort.Item, sz);
+	for i := 0; i < sz; i++ {
+		ascending[i] = counted{i, &comparisons};
+		descending[i] = counted{sz - i, &comparisons};
+	};
+	for name, slice := range map[string][]sort.Item{"ascending": ascending, "descending": descending} {
+		comparisons = 0;
+		sort.StableSortSlice(slice);
+		if comparisons != sz - 1 {
+			t.Errorf("%v: expected %v comparisons: got %v", name, sz - 1, comparisons);
+		};
+	};
+};
+
 func TestMakeSortSlice(t *testing.T) {
 	const sz = 1000;
 	ints := make([]sort.Item, sz);
@@ -92,3 +208,130 @@ func BenchmarkSortSlice(b *testing.B) {
 	};
 };
 
+// Inputs that have caused trouble for quicksorts.
+func patterns(sz int) map[string][]sort.Item {
+	p := make(map[string][]sort.Item);
+	for _, name := range []string{"random", "few", "sorted", "reversed", "equal", "sawtooth", "organ", "nearly"} {
+		p[name] = make([]sort.Item, sz);
+	};
+	for i := 0; i < sz; i++ {
+		p["random"][i] = Int(rand.Int());
+		p["few"][i] = Int(rand.Intn(4));
+		p["sorted"][i] = Int(i);
+		p["reversed"][i] = Int(sz - i);
+		p["equal"][i] = Int(7);
+		p["sawtooth"][i] = Int(i % 37);
+		if i < sz / 2 {
+			p["organ"][i] = Int(i);
+		} else {
+			p["organ"][i] = Int(sz - i);
+		};
+		p["nearly"][i] = Int(i);
+	};
+	for i := 0; sz > 0 && i < sz / 100 + 1; i++ {
+		a, b := rand.Intn(sz), rand.Intn(sz);
+		p["nearly"][a], p["nearly"][b] = p["nearly"][b], p["nearly"][a];
+	};
+	return p;
+};
+
+func check_sorted(t *testing.T, name string, original, sorted []sort.Item, reverse bool) {
+	if len(sorted) != len(original) {
+		t.Errorf("%v: expected %v items: got %v", name, len(original), len(sorted));
+		return;
+	};
+	counts := make(map[sort.Item]int);
+	for i, item := range sorted {
+		counts[item]++;
+		if i > 0 && (item.Precedes(sorted[i - 1]) != reverse) && item != sorted[i - 1] {
+			t.Errorf("%v: unexpected order at %v: %v : %v", name, i, sorted[i - 1], item);
+			return;
+		};
+	};
+	for _, item := range original {
+		counts[item]--;
+	};
+	for item, count := range counts {
+		if count != 0 {
+			t.Errorf("%v: %v has %v more copies than it should", name, item, count);
+		};
+	};
+};
+
+func TestSortSlicePatterns(t *testing.T) {
+	for _, sz := range []int{0, 1, 2, 11, 13, 49, 51, 100, 1000, 10000} {
+		for name, slice := range patterns(sz) {
+			original := make([]sort.Item, sz);
+			copy(original, slice);
+			check_sorted(t, name, original, sort.SortSlice(slice), false);
+			check_sorted(t, name, original, sort.ReverseSortSlice(slice), true);
+			for i := range slice {
+				if slice[i] != original[i] {
+					t.Errorf("%v: argument was modified", name);
+					break;
+				};
+			};
+		};
+	};
+};
+
+// The tree based algorithm that SortSlice() used to use (for comparison).
+func tree_sort(slice []sort.Item) []sort.Item {
+	tree := llrb_tree.Make(false);
+	for _, item := range slice {
+		tree.Insert(item);
+	};
+	sorted := make([]sort.Item, 0, len(slice));
+	for item := range tree.Iter(llrb_tree.IN_ORDER) {
+		sorted = append(sorted, item);
+	};
+	return sorted;
+};
+
+// Neither sorter modifies its argument so the same input can be reused.
+func benchmark_sort(b *testing.B, pattern string, sorter func([]sort.Item) []sort.Item) {
+	const sz = 1000;
+	b.StopTimer();
+	ints := patterns(sz)[pattern];
+	b.SetBytes(sz);
+	b.StartTimer();
+	for i := 0; i < b.N; i++ {
+		sorter(ints);
+	};
+};
+
+func BenchmarkSortSliceFew(b *testing.B) {
+	benchmark_sort(b, "few", sort.SortSlice);
+};
+
+func BenchmarkTreeSortSliceFew(b *testing.B) {
+	benchmark_sort(b, "few", tree_sort);
+};
+
+func BenchmarkSortSliceRandom(b *testing.B) {
+	benchmark_sort(b, "random", sort.SortSlice);
+};
+
+func BenchmarkTreeSortSliceRandom(b *testing.B) {
+	benchmark_sort(b, "random", tree_sort);
+};
+
+func BenchmarkSortSliceSorted(b *testing.B) {
+	benchmark_sort(b, "sorted", sort.SortSlice);
+};
+
+func BenchmarkTreeSortSliceSorted(b *testing.B) {
+	benchmark_sort(b, "sorted", tree_sort);
+};
+
+func BenchmarkStableSortSliceRandom(b *testing.B) {
+	benchmark_sort(b, "random", sort.StableSortSlice);
+};
+
+func BenchmarkStableSortSliceNearlySorted(b *testing.B) {
+	benchmark_sort(b, "nearly", sort.StableSortSlice);
+};
+
+func BenchmarkSortSliceNearlySorted(b *testing.B) {
+	benchmark_sort(b, "nearly", sort.SortSlice);
+};
@@ -0,0 +1,259 @@
+// Copyright 2010 -- Peter Williams, all rights reserved
+// Use of this source code is governed by the new BSD license.
+
+package sort;
+
+// Timsort (as described by Tim Peters for Python's list.sort()) is a stable
+// merge sort that takes advantage of any order already present in its input:
+// it splits the input into natural runs (extending short ones with binary
+// insertion sort) and merges adjacent runs of similar lengths.  A slice that
+// is already sorted (or reverse sorted) is sorted in O(N) time and the worst
+// case is O(N log N).  This version doesn't have Python's galloping mode but
+// does gallop to find the parts of two runs that need merging at all.
+
+// Runs shorter than this are extended using binary insertion sort.
+func min_run_length(n int) int {
+	r := 0;
+	for n >= 64 {
+		r |= n & 1;
+		n >>= 1;
+	};
+	return n + r;
+};
+
+// Return the end of the run that starts at data[a] making it ascending if it
+// is descending.  Only strictly descending runs are reversed so that equal
+// items stay in order.
+func count_run(data []Item, a, b int) int {
+	i := a + 1;
+	if i == b {
+		return i;
+	};
+	if data[i].Precedes(data[a]) {
+		for i++; i < b && data[i].Precedes(data[i - 1]); i++ {
+		};
+		reverse_range(data, a, i);
+	} else {
+		for i++; i < b && !data[i].Precedes(data[i - 1]); i++ {
+		};
+	};
+	return i;
+};
+
+// Sort data[a:b] given that data[a:start] is already sorted.  Each item is
+// inserted after any items equal to it.
+func binary_insertion_sort(data []Item, a, b, start int) {
+	for ; start < b; start++ {
+		pivot := data[start];
+		lo, hi := a, start;
+		for lo < hi {
+			mid := lo + (hi - lo) / 2;
+			if pivot.Precedes(data[mid]) {
+				hi = mid;
+			} else {
+				lo = mid + 1;
+			};
+		};
+		for i := start; i > lo; i-- {
+			data[i] = data[i - 1];
+		};
+		data[lo] = pivot;
+	};
+};
+
+// Return the number of items at the start of sorted run that precede item
+// (or, if after, that do not follow it) searching exponentially from the
+// start (or, if from_end, from the end) and then by bisection.
+func gallop(item Item, run []Item, after, from_end bool) int {
+	// before(x) is true for the items in the part being counted
+	before := func(x Item) bool {
+		if after {
+			return !item.Precedes(x);
+		};
+		return x.Precedes(item);
+	};
+	// The answer is the index of the first item in run that isn't before()
+	// and is first narrowed down to lo <= answer <= hi.
+	lo, hi := 0, len(run);
+	if from_end {
+		for step := 1; lo < hi; step *= 2 {
+			if before(run[hi - 1]) {
+				lo = hi;
+				break;
+			};
+			next := hi - step;
+			if next < 0 {
+				next = 0;
+			};
+			if before(run[next]) {
+				lo, hi = next + 1, hi - 1;
+				break;
+			};
+			hi = next;
+		};
+	} else {
+		for step := 1; lo < hi; step *= 2 {
+			if !before(run[lo]) {
+				hi = lo;
+				break;
+			};
+			next := lo + step;
+			if next > len(run) {
+				next = len(run);
+			};
+			if !before(run[next - 1]) {
+				lo, hi = lo + 1, next - 1;
+				break;
+			};
+			lo = next;
+		};
+	};
+	for lo < hi {
+		mid := lo + (hi - lo) / 2;
+		if before(run[mid]) {
+			lo = mid + 1;
+		} else {
+			hi = mid;
+		};
+	};
+	return lo;
+};
+
+// Pending runs are described by their starts and lengths.
+type run struct {
+	start, length int;
+};
+
+type timsort struct {
+	data []Item;
+	runs []run;
+	// holds a copy of the shorter run during merges
+	tmp []Item;
+};
+
+// Merge the adjacent runs at positions i and i + 1 on the stack.
+func (this *timsort) merge_at(i int) {
+	a, b := this.runs[i], this.runs[i + 1];
+	this.runs[i].length += b.length;
+	this.runs = append(this.runs[0:i + 1], this.runs[i + 2:]...);
+	left := this.data[a.start:a.start + a.length];
+	right := this.data[b.start:b.start + b.length];
+	// Items at the start of left that don't follow right[0] and those at
+	// the end of right that don't precede left's last item are already in
+	// place.
+	k := gallop(right[0], left, true, false);
+	left = left[k:];
+	if len(left) == 0 {
+		return;
+	};
+	right = right[0:gallop(left[len(left) - 1], right, false, true)];
+	if len(left) <= len(right) {
+		this.merge_lo(left, right);
+	} else {
+		this.merge_hi(left, right);
+	};
+};
+
+// Make sure that the buffer can hold n items.
+func (this *timsort) buffer(n int) []Item {
+	if cap(this.tmp) < n {
+		this.tmp = make([]Item, n);
+	};
+	return this.tmp[0:n];
+};
+
+// Merge left and right (which are adjacent in data) working from the start.
+func (this *timsort) merge_lo(left, right []Item) {
+	tmp := this.buffer(len(left));
+	copy(tmp, left);
+	dest := left[0:len(left) + len(right)];
+	i, j, k := 0, 0, 0;
+	for i < len(tmp) && j < len(right) {
+		// an item from right only goes first if it precedes the one from
+		// left so equal items stay in order
+		if right[j].Precedes(tmp[i]) {
+			dest[k] = right[j];
+			j++;
+		} else {
+			dest[k] = tmp[i];
+			i++;
+		};
+		k++;
+	};
+	copy(dest[k:], tmp[i:]);
+};
+
+// Merge left and right (which are adjacent in data) working from the end.
+func (this *timsort) merge_hi(left, right []Item) {
+	tmp := this.buffer(len(right));
+	copy(tmp, right);
+	dest := left[0:len(left) + len(right)];
+	i, j, k := len(left) - 1, len(tmp) - 1, len(dest) - 1;
+	for i >= 0 && j >= 0 {
+		// an item from left only goes last if right's follows it
+		if tmp[j].Precedes(left[i]) {
+			dest[k] = left[i];
+			i--;
+		} else {
+			dest[k] = tmp[j];
+			j--;
+		};
+		k--;
+	};
+	copy(dest[0:j + 1], tmp[0:j + 1]);
+};
+
+// Merge runs until the lengths of those on the stack decrease faster than the
+// Fibonacci numbers (so that there are O(log N) of them and merges are
+// between runs of similar lengths).  This is the corrected version of the
+// invariant (see de Gouw et al., "OpenJDK's java.utils.Collection.sort() is
+// broken").
+func (this *timsort) merge_collapse() {
+	for len(this.runs) > 1 {
+		n := len(this.runs) - 2;
+		r := this.runs;
+		if (n > 0 && r[n - 1].length <= r[n].length + r[n + 1].length) || (n > 1 && r[n - 2].length <= r[n - 1].length + r[n].length) {
+			if r[n - 1].length < r[n + 1].length {
+				n--;
+			};
+		} else if r[n].length > r[n + 1].length {
+			break;
+		};
+		this.merge_at(n);
+	};
+};
+
+func (this *timsort) merge_force_collapse() {
+	for len(this.runs) > 1 {
+		n := len(this.runs) - 2;
+		if n > 0 && this.runs[n - 1].length < this.runs[n + 1].length {
+			n--;
+		};
+		this.merge_at(n);
+	};
+};
+
+// Sort data in place keeping equal items in their original order.
+func stable_sort_in_place(data []Item) {
+	n := len(data);
+	if n < 2 {
+		return;
+	};
+	sorter := &timsort{data, nil, nil};
+	min_run := min_run_length(n);
+	for a := 0; a < n; {
+		b := count_run(data, a, n);
+		if b - a < min_run {
+			end := a + min_run;
+			if end > n {
+				end = n;
+			};
+			binary_insertion_sort(data, a, end, b);
+			b = end;
+		};
+		sorter.runs = append(sorter.runs, run{a, b - a});
+		sorter.merge_collapse();
+		a = b;
+	};
+	sorter.merge_force_collapse();
+};
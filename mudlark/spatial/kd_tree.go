@@ -0,0 +1,183 @@
+// Copyright 2010 -- Peter Williams, all rights reserved
+// Use of this source code is governed by the new BSD license.
+
+package spatial;
+
+// The k-d tree splits the plane alternately by x (at even depths) and by y
+// (at odd depths).  The entries in a node's left subtree have coordinates no
+// greater than the node's own in the node's dimension and those in its right
+// subtree coordinates no less.  It is kept balanced in the manner of a
+// scapegoat tree: no subtree may hold more than alpha of its parent's nodes
+// and when an insertion breaks that rule the highest subtree in which it was
+// broken is rebuilt from scratch (with the median entry at the root).  Deleted
+// entries are only marked as such until they make up half of the tree, which
+// is then rebuilt without them.
+
+const alpha = 0.7;
+
+type kd_node struct {
+	entry *entry;
+	left, right *kd_node;
+	// the number of nodes (deleted or not) in the subtree
+	size int;
+	deleted bool;
+};
+
+func (this *kd_node) get_size() int {
+	if this == nil {
+		return 0;
+	};
+	return this.size;
+};
+
+func coordinate(p Point, depth int) float64 {
+	if depth % 2 == 0 {
+		return p.X;
+	};
+	return p.Y;
+};
+
+func (this *Index) kd_insert(e *entry) {
+	e.node = &kd_node{e, nil, nil, 1, false};
+	var path []*kd_node;
+	link := &this.root;
+	var scapegoat **kd_node;
+	scapegoat_depth := 0;
+	for depth := 0; *link != nil; depth++ {
+		node := *link;
+		path = append(path, node);
+		node.size++;
+		next := &node.right;
+		if coordinate(e.Point, depth) < coordinate(node.entry.Point, depth) {
+			next = &node.left;
+		};
+		if scapegoat == nil && float64((*next).get_size() + 1) > alpha * float64(node.size) {
+			scapegoat, scapegoat_depth = link, depth;
+		};
+		link = next;
+	};
+	*link = e.node;
+	if scapegoat != nil {
+		removed := this.rebuild(scapegoat, scapegoat_depth);
+		for _, node := range path[0:scapegoat_depth] {
+			node.size -= removed;
+		};
+	};
+};
+
+func (this *Index) kd_delete(e *entry) {
+	e.node.deleted = true;
+	this.deleted++;
+	if this.deleted * 2 > this.root.size {
+		this.rebuild(&this.root, 0);
+	};
+};
+
+// Rebuild the subtree at *link (which is at depth) leaving out any deleted
+// entries.  Returns the number of nodes that were left out.
+func (this *Index) rebuild(link **kd_node, depth int) (removed int) {
+	entries := make([]*entry, 0, (*link).size);
+	var collect func(node *kd_node);
+	collect = func(node *kd_node) {
+		if node == nil {
+			return;
+		};
+		collect(node.left);
+		if node.deleted {
+			removed++;
+		} else {
+			entries = append(entries, node.entry);
+		};
+		collect(node.right);
+	};
+	collect(*link);
+	this.deleted -= removed;
+	*link = build(entries, depth);
+	return;
+};
+
+// Build a perfectly balanced subtree at depth holding entries.
+func build(entries []*entry, depth int) *kd_node {
+	if len(entries) == 0 {
+		return nil;
+	};
+	m := len(entries) / 2;
+	select_nth(entries, m, depth);
+	node := &kd_node{entries[m], build(entries[0:m], depth + 1), build(entries[m + 1:], depth + 1), len(entries), false};
+	entries[m].node = node;
+	return node;
+};
+
+// Rearrange entries so that the k'th is the one that would be there if they
+// were sorted by their coordinates for depth with no entry before it having a
+// greater coordinate and none after it a smaller one (Hoare's selection
+// algorithm).
+func select_nth(entries []*entry, k, depth int) {
+	lo, hi := 0, len(entries) - 1;
+	for lo < hi {
+		pivot := coordinate(entries[lo + (hi - lo) / 2].Point, depth);
+		i, j := lo, hi;
+		for i <= j {
+			for coordinate(entries[i].Point, depth) < pivot {
+				i++;
+			};
+			for pivot < coordinate(entries[j].Point, depth) {
+				j--;
+			};
+			if i <= j {
+				entries[i], entries[j] = entries[j], entries[i];
+				i++;
+				j--;
+			};
+		};
+		// entries[j + 1:i] (if any) are all equal to pivot
+		switch {
+		case k <= j:
+			hi = j;
+		case k >= i:
+			lo = i;
+		default:
+			return;
+		};
+	};
+};
+
+// Pass the entries in the subtree (which is at depth) that are inside box to
+// visit.
+func (this *kd_node) search(box Box, depth int, visit func(*entry)) {
+	for node := this; node != nil; depth++ {
+		if !node.deleted && box.Contains(node.entry.Point) {
+			visit(node.entry);
+		};
+		split := coordinate(node.entry.Point, depth);
+		switch {
+		case coordinate(box.Max, depth) < split:
+			node = node.left;
+		case coordinate(box.Min, depth) > split:
+			node = node.right;
+		default:
+			node.left.search(box, depth + 1, visit);
+			node = node.right;
+		};
+	};
+};
+
+// Look for an entry in the subtree (which is at depth) that is closer to p
+// than distance (squared) and, if there is one, update best and distance.
+func (this *kd_node) nearest(p Point, depth int, best **entry, distance *float64) {
+	if this == nil {
+		return;
+	};
+	if d := distance2(p, this.entry.Point); !this.deleted && d < *distance {
+		*best, *distance = this.entry, d;
+	};
+	near, far := this.left, this.right;
+	gap := coordinate(p, depth) - coordinate(this.entry.Point, depth);
+	if gap >= 0 {
+		near, far = far, near;
+	};
+	near.nearest(p, depth + 1, best, distance);
+	if gap * gap < *distance {
+		far.nearest(p, depth + 1, best, distance);
+	};
+};
@@ -0,0 +1,160 @@
+// Copyright 2010 -- Peter Williams, all rights reserved
+// Use of this source code is governed by the new BSD license.
+
+// The spatial package implements an index of values located at points in the
+// plane that supports queries for the points inside a rectangle and for the
+// point nearest to a given point.  The points are kept in a k-d tree, which
+// answers both kinds of query without regard to how the points are spread
+// along either axis, and in a map from each point to the entries located
+// there, which finds the entries to remove for Delete().
+//
+// The k-d tree is not balanced with the rotations of a left leaning red black
+// tree (see mudlark/tree/llrb_tree) as a rotation moves nodes to depths at
+// which they split the plane in the other dimension and so would break the
+// ordering of the subtrees below them.  Instead unbalanced subtrees are
+// rebuilt from scratch as in a scapegoat tree, which needs no rotations and
+// keeps the amortized cost of Insert() within O(log N log N).  A left leaning
+// red black tree is still used to put the results of RangeQuery() in order.
+package spatial;
+
+import (
+	"math";
+	"mudlark/tree/llrb_tree";
+);
+
+// Point is a location in the plane.
+type Point struct {
+	X, Y float64;
+};
+
+// Box is a rectangle with sides parallel to the axes.  It contains the points
+// whose coordinates lie between those of Min and Max (inclusive).
+type Box struct {
+	Min, Max Point;
+};
+
+// Contains returns true if p lies inside the box.
+func (this Box) Contains(p Point) bool {
+	return p.X >= this.Min.X && p.X <= this.Max.X && p.Y >= this.Min.Y && p.Y <= this.Max.Y;
+};
+
+// Entry is a value and its location.
+type Entry struct {
+	Point;
+	Value interface{};
+};
+
+// Entries are ordered by x and then by y and entries at the same point by
+// when they were inserted.
+type entry struct {
+	Entry;
+	id uint64;
+	// the entry's node in the k-d tree
+	node *kd_node;
+};
+
+func (this *entry) Precedes(other interface{}) bool {
+	that := other.(*entry);
+	switch {
+	case this.X != that.X:
+		return this.X < that.X;
+	case this.Y != that.Y:
+		return this.Y < that.Y;
+	};
+	return this.id < that.id;
+};
+
+// Index is a collection of values located at points in the plane.  Any number
+// of values may be located at the same point.  Instances of Index must be
+// created using Make().
+type Index struct {
+	// the entries at each point in the order that they were inserted
+	points map[Point][]*entry;
+	count uint;
+	last_id uint64;
+	root *kd_node;
+	// the number of nodes in the k-d tree whose entries have been deleted
+	deleted int;
+};
+
+// Make an empty Index.
+func Make() (index *Index) {
+	index = new(Index);
+	index.points = make(map[Point][]*entry);
+	return;
+};
+
+// Insert value at point p.  Parts of the k-d tree occasionally have to be
+// rebuilt so this takes O(log N log N) amortized time.
+func (this *Index) Insert(p Point, value interface{}) {
+	this.last_id++;
+	e := &entry{Entry{p, value}, this.last_id, nil};
+	this.points[p] = append(this.points[p], e);
+	this.count++;
+	this.kd_insert(e);
+};
+
+// Delete value from point p.  If value has been inserted there more than once
+// only one instance is deleted.  found is false if value isn't at p.  Values
+// are compared using == so they must be of comparable types.
+func (this *Index) Delete(p Point, value interface{}) (found bool) {
+	entries := this.points[p];
+	for i, e := range entries {
+		if e.Value == value {
+			if len(entries) == 1 {
+				this.points[p] = nil, false;
+			} else {
+				copy(entries[i:], entries[i + 1:]);
+				this.points[p] = entries[0:len(entries) - 1];
+			};
+			this.count--;
+			this.kd_delete(e);
+			return true;
+		};
+	};
+	return;
+};
+
+// Len returns the number of entries in the index.
+func (this *Index) Len() uint {
+	return this.count;
+};
+
+// RangeQuery returns a channel that will emit the entries inside box ordered
+// by x and then y.  Finding them takes about O(sqrt(N) + K) time where K is
+// the number found (plus O(K log K) to put them in order) however the points
+// are spread.
+func (this *Index) RangeQuery(box Box) <-chan Entry {
+	c := make(chan Entry);
+	go func() {
+		found := llrb_tree.Make(true);
+		this.root.search(box, 0, func(e *entry) {
+			found.Insert(e);
+		});
+		for item := range found.Iter(llrb_tree.IN_ORDER) {
+			c <- item.(*entry).Entry;
+		};
+		close(c);
+	}();
+	return c;
+};
+
+func distance2(a, b Point) float64 {
+	dx, dy := a.X - b.X, a.Y - b.Y;
+	return dx * dx + dy * dy;
+};
+
+// NearestPoint returns the entry closest (by euclidean distance) to p.  found
+// is false if the index is empty.  The search descends the k-d tree towards p
+// and only looks on the far side of a split if the split is closer to p than
+// the closest entry found so far: typically O(log N) time and O(sqrt(N)) at
+// worst.
+func (this *Index) NearestPoint(p Point) (nearest Entry, found bool) {
+	var best *entry;
+	distance := math.Inf(1);
+	this.root.nearest(p, 0, &best, &distance);
+	if best != nil {
+		nearest, found = best.Entry, true;
+	};
+	return;
+};
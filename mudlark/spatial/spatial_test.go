@@ -0,0 +1,206 @@
+// Copyright 2010 -- Peter Williams, all rights reserved
+// Use of this source code is governed by the new BSD license.
+
+package spatial;
+
+import (
+	"testing";
+	"math";
+	"rand";
+);
+
+func random_points(n int) (points []Point) {
+	for i := 0; i < n; i++ {
+		// use a coarse grid so that there are duplicates
+		points = append(points, Point{float64(rand.Intn(100)), float64(rand.Intn(100))});
+	};
+	return;
+};
+
+func TestRangeQuery(t *testing.T) {
+	index := Make();
+	points := random_points(1000);
+	for i, p := range points {
+		index.Insert(p, i);
+	};
+	for n := 0; n < 50; n++ {
+		x, y := float64(rand.Intn(100)), float64(rand.Intn(100));
+		box := Box{Point{x, y}, Point{x + float64(rand.Intn(30)), y + float64(rand.Intn(30))}};
+		expected := make(map[int]bool);
+		for i, p := range points {
+			if box.Contains(p) {
+				expected[i] = true;
+			};
+		};
+		got := 0;
+		for e := range index.RangeQuery(box) {
+			if !expected[e.Value.(int)] || e.Point != points[e.Value.(int)] {
+				t.Errorf("Unexpected entry %v in %v", e, box);
+			};
+			got++;
+		};
+		if got != len(expected) {
+			t.Errorf("Expected %v entries in %v: got %v", len(expected), box, got);
+		};
+	};
+};
+
+func TestNearestPoint(t *testing.T) {
+	index := Make();
+	if _, found := index.NearestPoint(Point{0, 0}); found {
+		t.Errorf("Found nearest point in empty index");
+	};
+	points := random_points(500);
+	for i, p := range points {
+		index.Insert(p, i);
+	};
+	for n := 0; n < 100; n++ {
+		p := Point{rand.Float64() * 120 - 10, rand.Float64() * 120 - 10};
+		best := distance2(p, points[0]);
+		for _, q := range points {
+			if d := distance2(p, q); d < best {
+				best = d;
+			};
+		};
+		e, found := index.NearestPoint(p);
+		if !found || distance2(p, e.Point) != best {
+			t.Errorf("Nearest to %v: got %v at distance %v: expected distance %v", p, e, distance2(p, e.Point), best);
+		};
+	};
+};
+
+func TestDelete(t *testing.T) {
+	index := Make();
+	index.Insert(Point{1, 1}, "a");
+	index.Insert(Point{1, 1}, "b");
+	index.Insert(Point{1, 1}, "a");
+	index.Insert(Point{2, 2}, "c");
+	if index.Delete(Point{1, 1}, "c") || index.Delete(Point{3, 3}, "a") {
+		t.Errorf("Deleted absent entry");
+	};
+	if !index.Delete(Point{1, 1}, "a") || !index.Delete(Point{1, 1}, "a") || index.Delete(Point{1, 1}, "a") {
+		t.Errorf("Wrong number of deletions");
+	};
+	if index.Len() != 2 {
+		t.Errorf("Expected 2 entries: got %v", index.Len());
+	};
+	var values []interface{};
+	for e := range index.RangeQuery(Box{Point{0, 0}, Point{5, 5}}) {
+		values = append(values, e.Value);
+	};
+	if len(values) != 2 || values[0] != "b" || values[1] != "c" {
+		t.Errorf("Expected [b c]: got %v", values);
+	};
+	if e, _ := index.NearestPoint(Point{1.2, 1.2}); e.Value != "b" {
+		t.Errorf("Expected nearest b: got %v", e);
+	};
+};
+
+// Check the k-d tree's ordering, sizes and balance and return its height.
+func check_kd_tree(t *testing.T, node *kd_node, depth int, lo, hi Point) (height int) {
+	if node == nil {
+		return 0;
+	};
+	p := node.entry.Point;
+	if p.X < lo.X || p.X > hi.X || p.Y < lo.Y || p.Y > hi.Y {
+		t.Errorf("Entry %v outside its region %v", node.entry.Entry, Box{lo, hi});
+	};
+	if node.entry.node != node {
+		t.Errorf("Entry %v doesn't refer to its node", node.entry.Entry);
+	};
+	if size := node.left.get_size() + node.right.get_size() + 1; size != node.size {
+		t.Errorf("Node size %v: expected %v", node.size, size);
+	};
+	if float64(node.left.get_size()) > alpha * float64(node.size) || float64(node.right.get_size()) > alpha * float64(node.size) {
+		t.Errorf("Unbalanced node: %v = %v + %v + 1", node.size, node.left.get_size(), node.right.get_size());
+	};
+	left_hi, right_lo := hi, lo;
+	if depth % 2 == 0 {
+		left_hi.X, right_lo.X = p.X, p.X;
+	} else {
+		left_hi.Y, right_lo.Y = p.Y, p.Y;
+	};
+	height = check_kd_tree(t, node.left, depth + 1, lo, left_hi);
+	if h := check_kd_tree(t, node.right, depth + 1, right_lo, hi); h > height {
+		height = h;
+	};
+	return height + 1;
+};
+
+func check_index(t *testing.T, index *Index) {
+	inf := math.Inf(1);
+	height := check_kd_tree(t, index.root, 0, Point{-inf, -inf}, Point{inf, inf});
+	if size := index.root.get_size(); size > 0 {
+		if max := math.Log(float64(size)) / math.Log(1 / alpha) + 2; float64(height) > max {
+			t.Errorf("Height %v for %v nodes", height, size);
+		};
+	};
+	if live := uint(index.root.get_size() - index.deleted); live != index.Len() {
+		t.Errorf("%v live nodes for %v entries", live, index.Len());
+	};
+};
+
+// Points concentrated in a few narrow vertical bands.
+func clustered_points(n int) (points []Point) {
+	for i := 0; i < n; i++ {
+		points = append(points, Point{float64(rand.Intn(3)), rand.Float64() * 1000});
+	};
+	return;
+};
+
+func TestClustered(t *testing.T) {
+	index := Make();
+	points := clustered_points(3000);
+	for i, p := range points {
+		index.Insert(p, i);
+	};
+	check_index(t, index);
+	for i := 0; i < len(points); i += 2 {
+		if !index.Delete(points[i], i) {
+			t.Errorf("Failed to delete %v at %v", i, points[i]);
+		};
+		if i % 500 == 0 {
+			check_index(t, index);
+		};
+	};
+	check_index(t, index);
+	for n := 0; n < 50; n++ {
+		y := rand.Float64() * 1000;
+		box := Box{Point{0, y}, Point{2, y + 20}};
+		expected := 0;
+		for i := 1; i < len(points); i += 2 {
+			if box.Contains(points[i]) {
+				expected++;
+			};
+		};
+		got := 0;
+		var last Point;
+		for e := range index.RangeQuery(box) {
+			if e.Value.(int) % 2 == 0 || !box.Contains(e.Point) {
+				t.Errorf("Unexpected entry %v in %v", e, box);
+			};
+			if got > 0 && (e.X < last.X || (e.X == last.X && e.Y < last.Y)) {
+				t.Errorf("Entry %v out of order after %v", e, last);
+			};
+			last = e.Point;
+			got++;
+		};
+		if got != expected {
+			t.Errorf("Expected %v entries in %v: got %v", expected, box, got);
+		};
+	};
+};
+
+func BenchmarkClusteredRangeQuery(b *testing.B) {
+	b.StopTimer();
+	index := Make();
+	for i, p := range clustered_points(100000) {
+		index.Insert(p, i);
+	};
+	b.StartTimer();
+	for i := 0; i < b.N; i++ {
+		y := rand.Float64() * 1000;
+		for _ = range index.RangeQuery(Box{Point{0, y}, Point{2, y + 1}}) {
+		};
+	};
+};
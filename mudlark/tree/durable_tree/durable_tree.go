@@ -0,0 +1,417 @@
+// Copyright 2010 -- Peter Williams, all rights reserved
+// Use of this source code is governed by the new BSD license.
+
+// The durable_tree package implements left leaning red black trees (see
+// mudlark/tree/llrb_tree) whose contents survive the process crashing.
+//
+// Each insertion or deletion is appended to a log file before it is applied
+// to the tree and the whole tree is periodically written (in order) to a
+// snapshot file so that the log can be emptied.  When a tree is opened its
+// contents are recovered by loading the snapshot and then replaying the log.
+// Every record in both files carries checksums of its header and of its
+// payload.  A log record that was only partly written when the process died
+// is discarded during recovery but damage anywhere else is reported.
+package durable_tree;
+
+import (
+	"bufio";
+	"encoding/binary";
+	"hash/crc32";
+	"io";
+	"os";
+	"path";
+	"mudlark/tree/llrb_tree";
+);
+
+// Codec converts items to and from the byte strings stored in the files.
+// Decode(Encode(item)) must return an item equal to item.
+type Codec interface {
+	Encode(item llrb_tree.Item) ([]byte, os.Error);
+	Decode(data []byte) (llrb_tree.Item, os.Error);
+};
+
+// DefaultSnapshotInterval is the number of log records after which a new
+// snapshot is written unless changed with SetSnapshotInterval().
+const DefaultSnapshotInterval = 10000;
+
+// ErrCorrupt is returned by Open() if the snapshot file or any log record
+// but the last (which may have been torn by a crash) is damaged or malformed.
+// The log is left untouched in that case.
+var ErrCorrupt = os.NewError("durable_tree: corrupt snapshot or log");
+
+// The names of the files kept in the tree's directory.
+const (
+	snapshot_name = "snapshot";
+	log_name = "log";
+);
+
+// Log record operations.
+const (
+	op_insert = 'I';
+	op_delete = 'D';
+);
+
+// Records are framed as the length of their payload, the CRC-32 of their
+// payload and the CRC-32 of those two fields (all 4 bytes little endian)
+// followed by the payload.  The header's own checksum means that a damaged
+// length is never mistaken for a record that runs off the end of the file.
+const header_size = 12;
+
+func write_record(w io.Writer, payload []byte) (err os.Error) {
+	buf := make([]byte, header_size + len(payload));
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(len(payload)));
+	binary.LittleEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(payload));
+	binary.LittleEndian.PutUint32(buf[8:12], crc32.ChecksumIEEE(buf[0:8]));
+	copy(buf[header_size:], payload);
+	_, err = w.Write(buf);
+	return;
+};
+
+type record_reader struct {
+	reader *bufio.Reader;
+	// the number of bytes successfully read and the size of the file
+	offset, size int64;
+	// set if reading stopped at a damaged record that isn't the last one
+	corrupt bool;
+};
+
+func new_record_reader(file *os.File) (r *record_reader, err os.Error) {
+	r = new(record_reader);
+	if r.size, err = file.Seek(0, 2); err != nil {
+		return nil, err;
+	};
+	if _, err = file.Seek(0, 0); err != nil {
+		return nil, err;
+	};
+	r.reader = bufio.NewReader(file);
+	return;
+};
+
+// Read the next record.  ok will be false at the end of the file or if the
+// next record is incomplete or damaged.  Only the last record can have been
+// torn by a crash so a damaged record with more data after it (or a damaged
+// header, whose length can't be trusted, with anything after it) also sets
+// corrupt.
+func (this *record_reader) next() (payload []byte, ok bool) {
+	var header [header_size]byte;
+	if _, err := io.ReadFull(this.reader, header[0:]); err != nil {
+		return;
+	};
+	end := this.offset + header_size;
+	if crc32.ChecksumIEEE(header[0:8]) != binary.LittleEndian.Uint32(header[8:12]) {
+		this.corrupt = end < this.size;
+		return;
+	};
+	end += int64(binary.LittleEndian.Uint32(header[0:4]));
+	if end > this.size {
+		return;
+	};
+	payload = make([]byte, end - this.offset - header_size);
+	if _, err := io.ReadFull(this.reader, payload); err != nil {
+		return nil, false;
+	};
+	if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(header[4:8]) {
+		this.corrupt = end < this.size;
+		return nil, false;
+	};
+	this.offset = end;
+	return payload, true;
+};
+
+func not_found(err os.Error) bool {
+	e, ok := err.(*os.PathError);
+	return ok && e.Error == os.ENOENT;
+};
+
+// Tree is a llrb_tree.Tree whose contents are kept in a directory so that
+// they survive the process crashing.  Instances of Tree must be created using
+// Open() and should be closed with Close() when no longer needed.
+type Tree struct {
+	tree *llrb_tree.Tree;
+	codec Codec;
+	dir string;
+	log *os.File;
+	// the size of the log file
+	log_size int64;
+	// the sequence number of the last logged operation
+	seq uint64;
+	// the number of log records written since the last snapshot
+	records uint;
+	snapshot_interval uint;
+	sync bool;
+	// the error (if any) from the last automatic snapshot
+	snapshot_err os.Error;
+};
+
+// Open the tree kept in directory dir (creating it if necessary) recovering
+// its contents from the snapshot and log files.  The parameter "filtered"
+// determines whether duplicate items will be filtered out (or kept) during
+// insertion and should be the same every time a directory is opened.
+func Open(dir string, filtered bool, codec Codec) (tree *Tree, err os.Error) {
+	tree = new(Tree);
+	tree.tree = llrb_tree.Make(filtered);
+	tree.codec = codec;
+	tree.dir = dir;
+	tree.snapshot_interval = DefaultSnapshotInterval;
+	tree.sync = true;
+	if err = os.MkdirAll(dir, 0777); err != nil {
+		return nil, err;
+	};
+	if err = tree.load_snapshot(); err != nil {
+		return nil, err;
+	};
+	if err = tree.replay_log(); err != nil {
+		return nil, err;
+	};
+	tree.log, err = os.Open(path.Join(dir, log_name), os.O_WRONLY | os.O_APPEND | os.O_CREAT, 0666);
+	if err != nil {
+		return nil, err;
+	};
+	return;
+};
+
+func (this *Tree) load_snapshot() (err os.Error) {
+	file, err := os.Open(path.Join(this.dir, snapshot_name), os.O_RDONLY, 0);
+	if err != nil {
+		if not_found(err) {
+			err = nil;
+		};
+		return;
+	};
+	defer file.Close();
+	r, err := new_record_reader(file);
+	if err != nil {
+		return;
+	};
+	header, ok := r.next();
+	if !ok || len(header) != 16 {
+		return ErrCorrupt;
+	};
+	this.seq = binary.LittleEndian.Uint64(header[0:8]);
+	for count := binary.LittleEndian.Uint64(header[8:16]); count > 0; count-- {
+		data, ok := r.next();
+		if !ok {
+			return ErrCorrupt;
+		};
+		item, err := this.codec.Decode(data);
+		if err != nil {
+			return err;
+		};
+		this.tree.Insert(item);
+	};
+	return;
+};
+
+func (this *Tree) replay_log() (err os.Error) {
+	name := path.Join(this.dir, log_name);
+	file, err := os.Open(name, os.O_RDONLY, 0);
+	if err != nil {
+		if not_found(err) {
+			err = nil;
+		};
+		return;
+	};
+	r, err := new_record_reader(file);
+	if err != nil {
+		file.Close();
+		return;
+	};
+	for {
+		payload, ok := r.next();
+		if !ok {
+			break;
+		};
+		if len(payload) < 9 {
+			file.Close();
+			return ErrCorrupt;
+		};
+		seq := binary.LittleEndian.Uint64(payload[1:9]);
+		if seq <= this.seq {
+			// already included in the snapshot
+			continue;
+		};
+		item, err := this.codec.Decode(payload[9:]);
+		if err != nil {
+			file.Close();
+			return err;
+		};
+		switch payload[0] {
+		case op_insert:
+			this.tree.Insert(item);
+		case op_delete:
+			this.tree.Delete(item);
+		default:
+			file.Close();
+			return ErrCorrupt;
+		};
+		this.seq = seq;
+		this.records++;
+	};
+	file.Close();
+	if r.corrupt {
+		// the records after the damaged one can't be trusted to be
+		// applied on their own so leave the log for inspection
+		return ErrCorrupt;
+	};
+	this.log_size = r.offset;
+	if r.offset < r.size {
+		// discard the torn record
+		err = os.Truncate(name, r.offset);
+	};
+	return;
+};
+
+func (this *Tree) append(op byte, item llrb_tree.Item) (err os.Error) {
+	data, err := this.codec.Encode(item);
+	if err != nil {
+		return;
+	};
+	payload := make([]byte, 9 + len(data));
+	payload[0] = op;
+	binary.LittleEndian.PutUint64(payload[1:9], this.seq + 1);
+	copy(payload[9:], data);
+	if err = write_record(this.log, payload); err == nil && this.sync {
+		err = this.log.Sync();
+	};
+	if err != nil {
+		// Don't leave a partial record in the middle of the log.
+		this.log.Truncate(this.log_size);
+		return;
+	};
+	this.log_size += int64(header_size + len(payload));
+	this.seq++;
+	this.records++;
+	return;
+};
+
+// A failed snapshot doesn't undo the change that triggered it (which has
+// been logged) so its error is kept for SnapshotErr() rather than returned.
+// It will be tried again after the next change.
+func (this *Tree) snapshot_if_due() {
+	if this.snapshot_interval != 0 && this.records >= this.snapshot_interval {
+		this.snapshot_err = this.Snapshot();
+	};
+};
+
+// Insert item in the tree.  See llrb_tree.Tree.Insert().  The tree is not
+// changed if the insertion can't be logged (and err says why) but once it
+// has been logged it stands even if the snapshot that it triggers fails (see
+// SnapshotErr()).
+func (this *Tree) Insert(item llrb_tree.Item) (err os.Error) {
+	if err = this.append(op_insert, item); err != nil {
+		return;
+	};
+	this.tree.Insert(item);
+	this.snapshot_if_due();
+	return;
+};
+
+// Delete item from the tree.  See llrb_tree.Tree.Delete().  As with Insert()
+// the tree is only left unchanged if the deletion can't be logged.
+func (this *Tree) Delete(item llrb_tree.Item) (err os.Error) {
+	if !this.tree.Has(item) {
+		return;
+	};
+	if err = this.append(op_delete, item); err != nil {
+		return;
+	};
+	this.tree.Delete(item);
+	this.snapshot_if_due();
+	return;
+};
+
+// SnapshotErr returns the error (if any) from the last snapshot written
+// automatically after an Insert() or Delete() (see SetSnapshotInterval()).
+// Nothing is lost when one fails as the log keeps growing until a snapshot
+// succeeds.
+func (this *Tree) SnapshotErr() os.Error {
+	return this.snapshot_err;
+};
+
+// Find an item in the tree.  See llrb_tree.Tree.Find().
+func (this *Tree) Find(item llrb_tree.Item) (entry llrb_tree.Item, found bool) {
+	return this.tree.Find(item);
+};
+
+// Is there an instance equal to item in the tree.
+func (this *Tree) Has(item llrb_tree.Item) bool {
+	return this.tree.Has(item);
+};
+
+// Len returns the number of items in the tree.
+func (this *Tree) Len() uint {
+	return this.tree.Len();
+};
+
+// Iterate over the tree.  See llrb_tree.Tree.Iter().
+func (this *Tree) Iter(order int) <-chan llrb_tree.Item {
+	return this.tree.Iter(order);
+};
+
+// Snapshot writes the tree's contents to the snapshot file and empties the
+// log.  The new snapshot replaces the old one atomically so a crash while
+// writing it loses nothing.
+func (this *Tree) Snapshot() (err os.Error) {
+	name := path.Join(this.dir, snapshot_name);
+	file, err := os.Open(name + ".tmp", os.O_WRONLY | os.O_CREAT | os.O_TRUNC, 0666);
+	if err != nil {
+		return;
+	};
+	w := bufio.NewWriter(file);
+	header := make([]byte, 16);
+	binary.LittleEndian.PutUint64(header[0:8], this.seq);
+	binary.LittleEndian.PutUint64(header[8:16], uint64(this.tree.Len()));
+	err = write_record(w, header);
+	for item := range this.tree.Iter(llrb_tree.IN_ORDER) {
+		// keep going after an error so that the iteration finishes
+		if err == nil {
+			var data []byte;
+			if data, err = this.codec.Encode(item); err == nil {
+				err = write_record(w, data);
+			};
+		};
+	};
+	if err == nil {
+		err = w.Flush();
+	};
+	if err == nil {
+		err = file.Sync();
+	};
+	if cerr := file.Close(); err == nil {
+		err = cerr;
+	};
+	if err == nil {
+		err = os.Rename(name + ".tmp", name);
+	};
+	if err != nil {
+		os.Remove(name + ".tmp");
+		return;
+	};
+	// The log's records are all in the snapshot now.  (Should we crash
+	// before it is emptied their sequence numbers will stop them being
+	// replayed twice.)
+	if err = this.log.Truncate(0); err == nil {
+		this.log_size = 0;
+		this.records = 0;
+	};
+	return;
+};
+
+// SetSnapshotInterval sets the number of log records after which a new
+// snapshot is written.  An interval of 0 means that snapshots are only written
+// by calling Snapshot().
+func (this *Tree) SetSnapshotInterval(records uint) {
+	this.snapshot_interval = records;
+};
+
+// SetSync determines whether the log is synced to disk after every record
+// (the default).  Turning it off is much faster but changes made shortly
+// before a system (as opposed to process) crash may be lost.
+func (this *Tree) SetSync(sync bool) {
+	this.sync = sync;
+};
+
+// Close the tree's files.  The tree must not be used afterwards.
+func (this *Tree) Close() os.Error {
+	return this.log.Close();
+};
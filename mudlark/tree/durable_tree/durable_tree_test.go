@@ -0,0 +1,241 @@
+// Copyright 2010 -- Peter Williams, all rights reserved
+// Use of this source code is governed by the new BSD license.
+
+package durable_tree;
+
+import (
+	"testing";
+	"rand";
+	"os";
+	"path";
+	"encoding/binary";
+	"io/ioutil";
+	"mudlark/tree/llrb_tree";
+);
+
+const test_dir = "_test/durable_tree";
+
+type Int int;
+
+func (i Int) Precedes(other interface{}) bool {
+	return int(i) < int(other.(Int));
+};
+
+type int_codec struct{};
+
+func (int_codec) Encode(item llrb_tree.Item) ([]byte, os.Error) {
+	data := make([]byte, 8);
+	binary.LittleEndian.PutUint64(data, uint64(item.(Int)));
+	return data, nil;
+};
+
+func (int_codec) Decode(data []byte) (llrb_tree.Item, os.Error) {
+	if len(data) != 8 {
+		return nil, os.NewError("bad Int");
+	};
+	return Int(binary.LittleEndian.Uint64(data)), nil;
+};
+
+func open(t *testing.T, filtered bool) *Tree {
+	tree, err := Open(test_dir, filtered, int_codec{});
+	if err != nil {
+		t.Fatalf("Open failed: %v", err);
+	};
+	tree.SetSync(false);
+	return tree;
+};
+
+func contents(tree *Tree) (items []int) {
+	for item := range tree.Iter(llrb_tree.IN_ORDER) {
+		items = append(items, int(item.(Int)));
+	};
+	return;
+};
+
+func check_contents(t *testing.T, tree *Tree, expected []int) {
+	items := contents(tree);
+	if len(items) != len(expected) {
+		t.Errorf("Expected %v items: got %v", len(expected), len(items));
+		return;
+	};
+	for i := range items {
+		if items[i] != expected[i] {
+			t.Errorf("Item %v: expected %v got %v", i, expected[i], items[i]);
+		};
+	};
+};
+
+func random_changes(t *testing.T, tree *Tree, n int) {
+	for i := 0; i < n; i++ {
+		if err := tree.Insert(Int(rand.Intn(200))); err != nil {
+			t.Fatalf("Insert failed: %v", err);
+		};
+		if err := tree.Delete(Int(rand.Intn(200))); err != nil {
+			t.Fatalf("Delete failed: %v", err);
+		};
+	};
+};
+
+func TestRecovery(t *testing.T) {
+	os.RemoveAll(test_dir);
+	defer os.RemoveAll(test_dir);
+	for _, interval := range []uint{0, 7, 100} {
+		for _, filtered := range []bool{true, false} {
+			os.RemoveAll(test_dir);
+			tree := open(t, filtered);
+			tree.SetSnapshotInterval(interval);
+			random_changes(t, tree, 500);
+			expected := contents(tree);
+			tree.Close();
+			tree = open(t, filtered);
+			check_contents(t, tree, expected);
+			random_changes(t, tree, 100);
+			expected = contents(tree);
+			tree.Close();
+			tree = open(t, filtered);
+			check_contents(t, tree, expected);
+			tree.Close();
+		};
+	};
+};
+
+func TestTornRecord(t *testing.T) {
+	os.RemoveAll(test_dir);
+	defer os.RemoveAll(test_dir);
+	tree := open(t, false);
+	random_changes(t, tree, 100);
+	expected := contents(tree);
+	tree.Insert(Int(1000));
+	tree.Close();
+	name := path.Join(test_dir, log_name);
+	data, err := ioutil.ReadFile(name);
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err);
+	};
+	// lose the end of the last record
+	if err = ioutil.WriteFile(name, data[0:len(data) - 3], 0666); err != nil {
+		t.Fatalf("WriteFile failed: %v", err);
+	};
+	tree = open(t, false);
+	check_contents(t, tree, expected);
+	tree.Insert(Int(2000));
+	tree.Close();
+	tree = open(t, false);
+	if !tree.Has(Int(2000)) || tree.Has(Int(1000)) {
+		t.Errorf("Log not usable after discarding torn record");
+	};
+	tree.Close();
+};
+
+func TestSnapshotCrash(t *testing.T) {
+	os.RemoveAll(test_dir);
+	defer os.RemoveAll(test_dir);
+	tree := open(t, false);
+	tree.SetSnapshotInterval(0);
+	random_changes(t, tree, 100);
+	expected := contents(tree);
+	name := path.Join(test_dir, log_name);
+	data, _ := ioutil.ReadFile(name);
+	if err := tree.Snapshot(); err != nil {
+		t.Fatalf("Snapshot failed: %v", err);
+	};
+	tree.Close();
+	// pretend that we crashed before the log was emptied
+	ioutil.WriteFile(name, data, 0666);
+	tree = open(t, false);
+	check_contents(t, tree, expected);
+	tree.Close();
+};
+
+func TestCorruptSnapshot(t *testing.T) {
+	os.RemoveAll(test_dir);
+	defer os.RemoveAll(test_dir);
+	tree := open(t, true);
+	random_changes(t, tree, 10);
+	tree.Snapshot();
+	tree.Close();
+	name := path.Join(test_dir, snapshot_name);
+	data, _ := ioutil.ReadFile(name);
+	data[len(data) - 1] ^= 0xff;
+	ioutil.WriteFile(name, data, 0666);
+	if _, err := Open(test_dir, true, int_codec{}); err != ErrCorrupt {
+		t.Errorf("Expected %v: got %v", ErrCorrupt, err);
+	};
+};
+
+func TestCorruptLogRecord(t *testing.T) {
+	os.RemoveAll(test_dir);
+	defer os.RemoveAll(test_dir);
+	tree := open(t, false);
+	tree.SetSnapshotInterval(0);
+	for i := 0; i < 10; i++ {
+		tree.Insert(Int(i));
+	};
+	tree.Close();
+	name := path.Join(test_dir, log_name);
+	data, _ := ioutil.ReadFile(name);
+	// each record is a 12 byte header, an op, an 8 byte sequence number
+	// and an 8 byte Int
+	const record_size = 29;
+	if len(data) != 10 * record_size {
+		t.Fatalf("Expected %v bytes of log: got %v", 10 * record_size, len(data));
+	};
+	// damage the item in the middle record
+	data[5 * record_size + 24] ^= 0xff;
+	ioutil.WriteFile(name, data, 0666);
+	if _, err := Open(test_dir, false, int_codec{}); err != ErrCorrupt {
+		t.Errorf("Expected %v: got %v", ErrCorrupt, err);
+	};
+	// the records after the damaged one must not have been discarded
+	if after, _ := ioutil.ReadFile(name); len(after) != len(data) {
+		t.Errorf("Log truncated from %v to %v bytes", len(data), len(after));
+	};
+	// damage to the last record is treated as a torn write
+	data[5 * record_size + 24] ^= 0xff;
+	data[9 * record_size + 24] ^= 0xff;
+	ioutil.WriteFile(name, data, 0666);
+	tree = open(t, false);
+	check_contents(t, tree, []int{0, 1, 2, 3, 4, 5, 6, 7, 8});
+	tree.Close();
+	// a damaged length in the middle record pointing past the end of the
+	// log isn't mistaken for a torn write
+	data, _ = ioutil.ReadFile(name);
+	data[5 * record_size + 2] = 0xff;
+	ioutil.WriteFile(name, data, 0666);
+	if _, err := Open(test_dir, false, int_codec{}); err != ErrCorrupt {
+		t.Errorf("Expected %v: got %v", ErrCorrupt, err);
+	};
+	if after, _ := ioutil.ReadFile(name); len(after) != len(data) {
+		t.Errorf("Log truncated from %v to %v bytes", len(data), len(after));
+	};
+};
+
+func TestSnapshotFailure(t *testing.T) {
+	os.RemoveAll(test_dir);
+	defer os.RemoveAll(test_dir);
+	tree := open(t, false);
+	tree.SetSnapshotInterval(3);
+	// a directory in the way of the temporary snapshot file
+	tmp := path.Join(test_dir, snapshot_name + ".tmp");
+	if err := os.MkdirAll(tmp, 0777); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err);
+	};
+	for i := 0; i < 10; i++ {
+		if err := tree.Insert(Int(1)); err != nil {
+			t.Errorf("Insert %v failed: %v", i, err);
+		};
+	};
+	if tree.SnapshotErr() == nil || tree.Len() != 10 {
+		t.Errorf("Expected a snapshot error and 10 items: got %v and %v", tree.SnapshotErr(), tree.Len());
+	};
+	os.Remove(tmp);
+	if err := tree.Delete(Int(1)); err != nil || tree.SnapshotErr() != nil {
+		t.Errorf("Delete after failed snapshots: %v (%v)", err, tree.SnapshotErr());
+	};
+	tree.Close();
+	tree = open(t, false);
+	if tree.Len() != 9 {
+		t.Errorf("Expected 9 items after reopening: got %v", tree.Len());
+	};
+	tree.Close();
+};
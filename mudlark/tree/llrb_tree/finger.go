@@ -0,0 +1,154 @@
+// Copyright 2010 -- Peter Williams, all rights reserved
+// Use of this source code is governed by the new BSD license.
+
+package llrb_tree;
+
+import "sync/atomic";
+
+// A step on the path from the root of a tree to a node.  All of the items in
+// the subtree rooted at node follow lo and precede hi (where nil means
+// unbounded) as those are the items at which the path turned.
+type finger struct {
+	node *ll_rb_node;
+	lo, hi Item;
+};
+
+// Cursor remembers the position in a tree reached by a previous FindNear() or
+// InsertNear() so that a search for a nearby item can start from there rather
+// than from the root.  A Cursor is only a hint: once the tree has been
+// modified by anything other than the InsertNear() that returned it (or an
+// Insert() that overwrote an item) it is ignored and searches start from the
+// root as usual.
+type Cursor struct {
+	tree *Tree;
+	root *ll_rb_node;
+	mod_count uint;
+	path []finger;
+};
+
+// Return the part of the cursor's path whose last node's subtree is the
+// smallest that could contain item (or nil if the cursor can't be used).  The
+// path is copied so that extending it leaves the cursor alone.
+func (this *Tree) climb(cursor *Cursor, item Item) (path []finger) {
+	if cursor == nil || cursor.tree != this || cursor.root != this.root || cursor.mod_count != this.mod_count {
+		return;
+	};
+	top := len(cursor.path);
+	for top > 1 {
+		step := cursor.path[top - 1];
+		if (step.lo == nil || this.precedes(step.lo, item)) && (step.hi == nil || this.precedes(item, step.hi)) {
+			break;
+		};
+		top--;
+	};
+	path = make([]finger, top, top + 8);
+	for i := 0; i < top; i++ {
+		path[i] = cursor.path[i];
+	};
+	return;
+};
+
+// Extend path down the tree until item or a leaf is reached.
+func (this *Tree) descend(path []finger, item Item) ([]finger, Item, bool) {
+	if len(path) == 0 {
+		if this.root == nil {
+			return path, nil, false;
+		};
+		path = append(path, finger{this.root, nil, nil});
+	};
+	for {
+		step := path[len(path) - 1];
+		node := step.node;
+		var next finger;
+		if this.precedes(item, node.item) {
+			next = finger{node.left, step.lo, node.item};
+		} else if this.precedes(node.item, item) {
+			next = finger{node.right, node.item, step.hi};
+		} else {
+			return path, node.item, true;
+		};
+		if next.node == nil {
+			return path, nil, false;
+		};
+		path = append(path, next);
+	};
+	return path, nil, false;
+};
+
+func (this *Tree) new_cursor(path []finger) *Cursor {
+	return &Cursor{this, this.root, this.mod_count, path};
+};
+
+// FindNear is the same as Find() except that the search starts from the
+// position recorded in hint (which may be nil) and a Cursor for use as the
+// hint for the next search is returned.  When successive searches are for
+// items that are close together the search only has to climb back up the
+// tree as far as the smallest subtree that contains both items: typically
+// O(log d) where d is the distance between them, although it can be as much
+// as O(log N) when the two items straddle a node near the root.
+func (this *Tree) FindNear(hint *Cursor, item Item) (entry Item, found bool, cursor *Cursor) {
+	if this.metrics != nil {
+		atomic.AddUint64(&this.metrics.Finds, 1);
+	};
+	var path []finger;
+	path, entry, found = this.descend(this.climb(hint, item), item);
+	return entry, found, this.new_cursor(path);
+};
+
+// InsertNear is the same as Insert() except that the search for the insertion
+// point starts from the position recorded in hint (which may be nil) and a
+// Cursor positioned at item (or an item equal to it) is returned.  See
+// FindNear() regarding the number of comparisons made.  When an item is
+// added every ancestor of the new node still has to have its subtree size
+// (and, for a hashed tree, its hash) updated so that part costs O(log N)
+// (albeit without any comparisons).  Only when item overwrites an equal item
+// can the walk back up the tree stop early.
+func (this *Tree) InsertNear(hint *Cursor, item Item) (cursor *Cursor) {
+	if this.metrics != nil {
+		atomic.AddUint64(&this.metrics.Inserts, 1);
+	};
+	path := this.climb(hint, item);
+	if len(path) == 0 {
+		// start from the root (which is nil if the tree is empty)
+		path = []finger{finger{this.root, nil, nil}};
+	};
+	top := len(path) - 1;
+	node := path[top].node;
+	red, left_red := is_red(node), node != nil && is_red(node.left);
+	var sub *ll_rb_node;
+	var old Item;
+	if this.keep_duplicates {
+		sub = this.insert_keep_duplicates(node, item);
+	} else {
+		sub, old = this.insert(node, item);
+	};
+	// The ancestors need fixing up (and, if sub was copied, owning) only
+	// until a subtree that they can't tell has changed is reached but the
+	// sizes (and hashes) of all of them change if an item was added.
+	for top > 0 && (sub != node || sub.red != red || is_red(sub.left) != left_red || this.hasher != nil || old == nil) {
+		top--;
+		parent := path[top].node;
+		red, left_red = parent.red, is_red(parent.left);
+		owned := this.own(parent);
+		if parent.left == node {
+			owned.left = sub;
+		} else {
+			owned.right = sub;
+		};
+		node, sub = parent, this.fix_up(owned);
+	};
+	if top == 0 {
+		this.root = sub;
+		this.root.red = false;
+		path = path[0:0];
+	} else {
+		path = path[0:top + 1];
+	};
+	if old == nil {
+		this.count++;
+		this.mod_count++;
+	};
+	this.notify(old, item);
+	path, _, _ = this.descend(path, item);
+	return this.new_cursor(path);
+};
@@ -0,0 +1,161 @@
+// Copyright 2010 -- Peter Williams, all rights reserved
+// Use of this source code is governed by the new BSD license.
+
+package llrb_tree;
+
+import (
+	"testing";
+	"rand";
+);
+
+func check_tree(t *testing.T, tree *Tree, expected uint) {
+	if tree.Len() != expected {
+		t.Errorf("Expected %v items: got %v", expected, tree.Len());
+	};
+	if is_red(tree.root) {
+		t.Errorf("Red root");
+	};
+	black_height(t, tree.root);
+	if size := check_sizes(t, tree.root); size != expected {
+		t.Errorf("Expected root size %v: got %v", expected, size);
+	};
+	items := tree_items(tree);
+	for i := 1; i < len(items); i++ {
+		if items[i].Precedes(items[i - 1]) {
+			t.Errorf("Unexpected order: %v : %v", items[i - 1], items[i]);
+		};
+	};
+};
+
+func TestFindNear(t *testing.T) {
+	const sz = 1000;
+	tree := Make(true);
+	for i := 0; i < sz; i++ {
+		tree.Insert(Int(2 * i));
+	};
+	var metrics Metrics;
+	tree.Instrument(&metrics);
+	for i := 0; i < 2 * sz; i++ {
+		tree.Find(Int(i));
+	};
+	from_root := metrics.Comparisons;
+	metrics.Reset();
+	var cursor *Cursor;
+	for i := 0; i < 2 * sz; i++ {
+		var item Item;
+		var found bool;
+		item, found, cursor = tree.FindNear(cursor, Int(i));
+		if found != (i % 2 == 0) || (found && item != Int(i)) {
+			t.Errorf("FindNear(%v): got %v, %v", i, item, found);
+		};
+	};
+	if metrics.Comparisons * 2 > from_root {
+		t.Errorf("Sequential FindNear() made %v comparisons: Find() made %v", metrics.Comparisons, from_root);
+	};
+	for i := 0; i < 1000; i++ {
+		key := rand.Intn(2 * sz + 10) - 5;
+		item, found, next := tree.FindNear(cursor, Int(key));
+		expected, expected_found := tree.Find(Int(key));
+		if found != expected_found || item != expected {
+			t.Errorf("FindNear(%v): expected %v, %v: got %v, %v", key, expected, expected_found, item, found);
+		};
+		if rand.Intn(2) == 0 {
+			cursor = next;
+		};
+	};
+	// a cursor from another tree or from before a modification is ignored
+	other := make_tree(Int(-2), Int(2));
+	_, _, cursor = other.FindNear(nil, Int(2));
+	if item, found, _ := tree.FindNear(cursor, Int(500)); !found || item != Int(500) {
+		t.Errorf("FindNear() with foreign cursor: got %v, %v", item, found);
+	};
+	_, _, cursor = tree.FindNear(nil, Int(600));
+	tree.Delete(Int(600));
+	if _, found, _ := tree.FindNear(cursor, Int(600)); found {
+		t.Errorf("FindNear() found deleted item using stale cursor");
+	};
+	empty := Make(true);
+	if _, found, _ := empty.FindNear(nil, Int(1)); found {
+		t.Errorf("FindNear() found item in empty tree");
+	};
+};
+
+func TestInsertNear(t *testing.T) {
+	const sz = 2000;
+	tree := Make(true);
+	var cursor *Cursor;
+	for i := 0; i < sz; i++ {
+		cursor = tree.InsertNear(cursor, Int(i));
+		if item, found, _ := tree.FindNear(cursor, Int(i)); !found || item != Int(i) {
+			t.Errorf("InsertNear(%v) cursor: got %v, %v", i, item, found);
+		};
+	};
+	check_tree(t, tree, sz);
+	// overwriting and random (often useless) hints
+	cursors := make([]*Cursor, 0, 16);
+	count := uint(sz);
+	for i := 0; i < 5000; i++ {
+		key := Int(rand.Intn(2 * sz) - sz / 2);
+		if !tree.Has(key) {
+			count++;
+		};
+		var hint *Cursor;
+		if len(cursors) > 0 {
+			hint = cursors[rand.Intn(len(cursors))];
+		};
+		cursor = tree.InsertNear(hint, key);
+		if len(cursors) < cap(cursors) {
+			cursors = append(cursors, cursor);
+		} else {
+			cursors[rand.Intn(len(cursors))] = cursor;
+		};
+		if rand.Intn(10) == 0 {
+			tree.Delete(Int(rand.Intn(2 * sz) - sz / 2));
+			count = tree.Len();
+		};
+	};
+	check_tree(t, tree, count);
+	dups := Make(false);
+	cursor = nil;
+	for i := 0; i < sz; i++ {
+		cursor = dups.InsertNear(cursor, Int(i / 4));
+	};
+	check_tree(t, dups, sz);
+	for i, item := range tree_items(dups) {
+		if item != Int(i / 4) {
+			t.Errorf("Expected %v at %v: got %v", i / 4, i, item);
+		};
+	};
+};
+
+func TestInsertNearShared(t *testing.T) {
+	tree := MakeHashed(true, hash_key_value);
+	var cursor *Cursor;
+	for i := 0; i < 500; i++ {
+		cursor = tree.InsertNear(cursor, Int(2 * i));
+	};
+	check_hashes(t, tree.root);
+	txn := tree.Begin();
+	for i := 0; i < 500; i++ {
+		cursor = tree.InsertNear(cursor, Int(2 * i + 1));
+	};
+	check_tree(t, tree, 1000);
+	check_hashes(t, tree.root);
+	// the nodes shared with the transaction must have been left alone
+	check_tree(t, &txn.view, 500);
+	check_hashes(t, txn.view.root);
+	// runs of consecutive values in a tree of its own
+	hashed := MakeHashed(false, hash_key_value);
+	cursor = nil;
+	for i := 0; i < 1000; i++ {
+		cursor = hashed.InsertNear(cursor, Int(i / 3));
+		if i % 100 == 99 {
+			check_tree(t, hashed, uint(i + 1));
+			check_hashes(t, hashed.root);
+		};
+	};
+	if txn.Has(Int(1)) {
+		t.Errorf("Insertion into tree visible in transaction");
+	};
+	txn.Rollback();
+};
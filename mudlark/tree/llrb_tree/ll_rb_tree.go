@@ -10,6 +10,12 @@
 // being inserted combine the roles of both key and value.
 package llrb_tree;
 
+import (
+	"os";
+	"sync";
+	"sync/atomic";
+);
+
 // Items to be inserted in a tree must implement this interface and must
 // satisfy the following formal requirements (where a, b and c are all
 // instances of the same type):
@@ -25,181 +31,318 @@ type ll_rb_node struct {
 	item Item;
 	left, right *ll_rb_node;
 	red bool;
+	// the generation of the tree that owns (and may modify) this node
+	gen uint;
+	// the hash of the subtree rooted at this node (see MakeHashed())
+	hash uint64;
+	// the number of nodes in the subtree rooted at this node
+	size uint;
+};
+
+func is_red(node *ll_rb_node) bool { return node != nil && node.red; };
+
+func size_of(node *ll_rb_node) uint {
+	if node == nil {
+		return 0;
+	};
+	return node.size;
+};
+
+func resize(node *ll_rb_node) {
+	node.size = size_of(node.left) + size_of(node.right) + 1;
 };
 
-func new_ll_rb_node(item Item) *ll_rb_node {
+// Nodes may be shared between a tree and its transactions (see Begin()).
+// Only the tree whose generation matches a node's may modify that node in
+// place and any other tree wishing to modify it must work on a copy.  The
+// functions below that modify nodes are all methods of the Tree doing the
+// modifying and ensure that they only modify nodes that it owns.
+
+// Generations are issued by a single package-wide counter so that no two
+// trees that might share nodes can ever have the same generation.  A Tree's
+// zero generation is never issued so that trees that have never shared any
+// nodes do not need to be issued one.
+var generations struct {
+	sync.Mutex;
+	last uint;
+};
+
+func new_generation() (gen uint) {
+	generations.Lock();
+	generations.last++;
+	gen = generations.last;
+	generations.Unlock();
+	return;
+};
+
+func (this *Tree) new_node(item Item) *ll_rb_node {
 	node := new(ll_rb_node);
 	node.item = item;
 	node.red = true;
+	node.gen = this.gen;
+	resize(node);
+	this.rehash(node);
 	return node;
 };
 
-func is_red(node *ll_rb_node) bool { return node != nil && node.red; };
+func (this *Tree) own(node *ll_rb_node) *ll_rb_node {
+	if node.gen == this.gen {
+		return node;
+	};
+	clone := new(ll_rb_node);
+	*clone = *node;
+	clone.gen = this.gen;
+	return clone;
+};
 
-func flip_colours(node *ll_rb_node) {
+func (this *Tree) flip_colours(node *ll_rb_node) {
+	if this.metrics != nil {
+		atomic.AddUint64(&this.metrics.FlipColours, 1);
+	};
 	node.red = !node.red;
+	node.left = this.own(node.left);
 	node.left.red = !node.left.red;
+	node.right = this.own(node.right);
 	node.right.red = !node.right.red;
 };
 
-func rotate_left(node *ll_rb_node) *ll_rb_node {
-	tmp := node.right;
+func (this *Tree) rotate_left(node *ll_rb_node) *ll_rb_node {
+	if this.metrics != nil {
+		atomic.AddUint64(&this.metrics.RotateLefts, 1);
+	};
+	tmp := this.own(node.right);
 	node.right = tmp.left;
 	tmp.left = node;
 	tmp.red = node.red;
 	node.red = true;
+	resize(node);
+	this.rehash(node);
+	resize(tmp);
+	this.rehash(tmp);
 	return tmp;
 };
 
-func rotate_right(node *ll_rb_node) *ll_rb_node {
-	tmp := node.left;
+func (this *Tree) rotate_right(node *ll_rb_node) *ll_rb_node {
+	if this.metrics != nil {
+		atomic.AddUint64(&this.metrics.RotateRights, 1);
+	};
+	tmp := this.own(node.left);
 	node.left = tmp.right;
 	tmp.right = node;
 	tmp.red = node.red;
 	node.red = true;
+	resize(node);
+	this.rehash(node);
+	resize(tmp);
+	this.rehash(tmp);
 	return tmp;
 };
 
-func fix_up(node *ll_rb_node) *ll_rb_node {
+func (this *Tree) fix_up(node *ll_rb_node) *ll_rb_node {
 	if is_red(node.right) && !is_red(node.left) {
-		node = rotate_left(node);
+		node = this.rotate_left(node);
 	};
 	if is_red(node.left) && is_red(node.left.left) {
-		node = rotate_right(node);
+		node = this.rotate_right(node);
 	};
 	if is_red(node.left) && is_red(node.right) {
-		flip_colours(node);
+		this.flip_colours(node);
 	};
+	resize(node);
+	this.rehash(node);
 	return node;
 };
 
-func insert(node *ll_rb_node, item Item) (*ll_rb_node, bool) {
+// Returns the overwritten item (or nil if item was added to the tree).
+func (this *Tree) insert(node *ll_rb_node, item Item) (*ll_rb_node, Item) {
 	if node == nil {
-		return new_ll_rb_node(item), true;
+		return this.new_node(item), nil;
 	};
-	inserted := false;
-	if item.Precedes(node.item) {
-		node.left, inserted = insert(node.left, item);
-	} else if node.item.Precedes(item) {
-		node.right, inserted = insert(node.right, item);
+	node = this.own(node);
+	var old Item;
+	if this.precedes(item, node.item) {
+		node.left, old = this.insert(node.left, item);
+	} else if this.precedes(node.item, item) {
+		node.right, old = this.insert(node.right, item);
 	} else {
+		old = node.item;
 		node.item = item;
 	};
-	return fix_up(node), inserted;
+	return this.fix_up(node), old;
 };
 
-func insert_keep_duplicates(node *ll_rb_node, item Item) (*ll_rb_node) {
+func (this *Tree) insert_keep_duplicates(node *ll_rb_node, item Item) (*ll_rb_node) {
 	if node == nil {
-		return new_ll_rb_node(item);
+		return this.new_node(item);
 	};
-	if item.Precedes(node.item) {
-		node.left = insert_keep_duplicates(node.left, item);
+	node = this.own(node);
+	if this.precedes(item, node.item) {
+		node.left = this.insert_keep_duplicates(node.left, item);
 	} else {
-		node.right = insert_keep_duplicates(node.right, item);
+		node.right = this.insert_keep_duplicates(node.right, item);
 	};
-	return fix_up(node);
+	return this.fix_up(node);
 };
 
-func move_red_left(node *ll_rb_node) *ll_rb_node {
-	flip_colours(node);
+func (this *Tree) move_red_left(node *ll_rb_node) *ll_rb_node {
+	if this.metrics != nil {
+		atomic.AddUint64(&this.metrics.MoveRedLefts, 1);
+	};
+	this.flip_colours(node);
 	if (is_red(node.right.left)) {
-		node.right = rotate_right(node.right);
-		node = rotate_left(node);
-		flip_colours(node);
+		node.right = this.rotate_right(node.right);
+		node = this.rotate_left(node);
+		this.flip_colours(node);
 	};
 	return node;
 };
 
-func move_red_right(node *ll_rb_node) *ll_rb_node {
-	flip_colours(node);
+func (this *Tree) move_red_right(node *ll_rb_node) *ll_rb_node {
+	if this.metrics != nil {
+		atomic.AddUint64(&this.metrics.MoveRedRights, 1);
+	};
+	this.flip_colours(node);
 	if (is_red(node.left.left)) {
-		node = rotate_right(node);
-		flip_colours(node);
+		node = this.rotate_right(node);
+		this.flip_colours(node);
 	};
 	return node;
 };
 
-func delete_left_most(node *ll_rb_node) *ll_rb_node {
+func (this *Tree) delete_left_most(node *ll_rb_node) *ll_rb_node {
 	if node.left == nil {
 		return nil;
 	};
+	node = this.own(node);
 	if !is_red(node.left) && !is_red(node.left.left) {
-		node = move_red_left(node);
+		node = this.move_red_left(node);
 	};
-	node.left = delete_left_most(node.left);
-	return fix_up(node);
+	node.left = this.delete_left_most(node.left);
+	return this.fix_up(node);
 };
 
-func delete(node *ll_rb_node, item Item) (*ll_rb_node, bool) {
-	var deleted bool;
-	if item.Precedes(node.item) {
+// Unlike Sedgewick's original the item to delete is identified by its rank
+// (the number of items that come before it in the subtree) which must be
+// less than the size of the subtree.  The item's rank is found (along with
+// whether it is in the tree at all) by a search that doesn't modify the tree
+// so the deletion itself needs no comparisons and duplicates need no special
+// care.  Returns the deleted instance.
+func (this *Tree) delete(node *ll_rb_node, rank uint) (*ll_rb_node, Item) {
+	var deleted Item;
+	if rank < size_of(node.left) {
+		node = this.own(node);
 		if !is_red(node.left) && !is_red(node.left.left) {
-			node = move_red_left(node);
+			node = this.move_red_left(node);
 		};
-		node.left, deleted = delete(node.left, item);
+		node.left, deleted = this.delete(node.left, rank);
 	} else {
+		node = this.own(node);
 		if is_red(node.left) {
-			node = rotate_right(node);
+			node = this.rotate_right(node);
 		};
-		if !node.item.Precedes(item) && !item.Precedes(node.item) && node.right == nil {
-			return nil, true;
+		if rank == size_of(node.left) && node.right == nil {
+			return nil, node.item;
 		};
-		if !is_red(node.right) && !is_red(node.right.left) {
-			node = move_red_right(node);
+		if node.right != nil && !is_red(node.right) && !is_red(node.right.left) {
+			node = this.move_red_right(node);
 		};
-		if !node.item.Precedes(item) && !item.Precedes(node.item) {
+		if left := size_of(node.left); rank == left {
 			left_most := node.right;
 			for left_most.left != nil {
 				left_most = left_most.left;
 			};
+			deleted = node.item;
 			node.item = left_most.item;
-			node.right = delete_left_most(node.right);
-			deleted = true;
+			node.right = this.delete_left_most(node.right);
 		} else {
-			node.right, deleted = delete(node.right, item);
+			node.right, deleted = this.delete(node.right, rank - left - 1);
 		};
 	};
-	return fix_up(node), deleted;
+	return this.fix_up(node), deleted;
+};
+
+// ErrModified is the panic value used when a tree is structurally modified
+// (i.e. an item is inserted into or deleted from it) while an iteration over
+// it is in progress.
+var ErrModified = os.NewError("llrb_tree: tree modified during iteration");
+
+// The state of an iteration in progress.  The tree's modification count is
+// recorded when the iteration starts so that structural changes made while
+// it is under way can be detected before they cause items to be missed or
+// repeated.
+type iterator struct {
+	tree *Tree;
+	mod_count uint;
+	c chan<- Item;
+	// closed if the iteration is to be abandoned (nil if it can't be)
+	done <-chan struct{};
+};
+
+func new_iterator(tree *Tree, c chan<- Item) *iterator {
+	return &iterator{tree, tree.mod_count, c, nil};
+};
+
+// The panic value used to unwind an iteration that has been cancelled.
+var cancelled = os.NewError("llrb_tree: iteration cancelled");
+
+func (this *iterator) yield(item Item) {
+	if this.tree.mod_count != this.mod_count {
+		panic(ErrModified);
+	};
+	select {
+	case this.c <- item:
+	case <-this.done:
+		panic(cancelled);
+	};
+};
+
+// Close the channel once the iteration has finished or been cancelled.  Must
+// be deferred.
+func (this *iterator) finish() {
+	if x := recover(); x != nil && x != cancelled {
+		panic(x);
+	};
+	close(this.c);
 };
 
 // Iteration using recursion is safe because the depth of the tree should never
 // be greater than 2Log2(N) where N is the number of nodes in the tree and
 // (in general) will be approximately Log2(N).
 
-func iterate_preorder(node *ll_rb_node, c chan<- Item) {
+func iterate_preorder(node *ll_rb_node, it *iterator) {
 	if node == nil {
 		return;
 	};
-	c <- node.item;
-	iterate_preorder(node.left, c);
-	iterate_preorder(node.right, c);
+	it.yield(node.item);
+	iterate_preorder(node.left, it);
+	iterate_preorder(node.right, it);
 };
 
-func iterate_inorder(node *ll_rb_node, c chan<- Item) {
+func iterate_inorder(node *ll_rb_node, it *iterator) {
 	if node == nil {
 		return;
 	};
-	iterate_inorder(node.left, c);
-	c <- node.item;
-	iterate_inorder(node.right, c);
+	iterate_inorder(node.left, it);
+	it.yield(node.item);
+	iterate_inorder(node.right, it);
 };
 
-func iterate_postorder(node *ll_rb_node, c chan<- Item) {
+func iterate_postorder(node *ll_rb_node, it *iterator) {
 	if node == nil {
 		return;
 	};
-	iterate_postorder(node.left, c);
-	iterate_postorder(node.right, c);
-	c <- node.item;
+	iterate_postorder(node.left, it);
+	iterate_postorder(node.right, it);
+	it.yield(node.item);
 };
 
-func iterate_reverseorder(node *ll_rb_node, c chan<- Item) {
+func iterate_reverseorder(node *ll_rb_node, it *iterator) {
 	if node == nil {
 		return;
 	};
-	iterate_reverseorder(node.right, c);
-	c <- node.item;
-	iterate_reverseorder(node.left, c);
+	iterate_reverseorder(node.right, it);
+	it.yield(node.item);
+	iterate_reverseorder(node.left, it);
 };
 
 // Specify output order for iteration.
@@ -210,18 +353,100 @@ const (
 	REVERSE_ORDER;
 );
 
-func iterate(node *ll_rb_node, c chan<- Item, order int) {
+func iterate(node *ll_rb_node, it *iterator, order int) {
+	defer it.finish();
 	switch order {
 	case PRE_ORDER:
-		iterate_preorder(node, c);
+		iterate_preorder(node, it);
 	case IN_ORDER:
-		iterate_inorder(node, c);
+		iterate_inorder(node, it);
 	case POST_ORDER:
-		iterate_postorder(node, c);
+		iterate_postorder(node, it);
 	case REVERSE_ORDER:
-		iterate_reverseorder(node, c);
+		iterate_reverseorder(node, it);
 	};
-	close(c);
+};
+
+// Iterate in order over those items in the subtree that do not precede lo and
+// that precede hi (where nil means unbounded) skipping subtrees that lie
+// wholly outside the range.
+func (this *Tree) iterate_range(node *ll_rb_node, lo, hi Item, it *iterator) {
+	if node == nil {
+		return;
+	};
+	above_lo := lo == nil || !this.precedes(node.item, lo);
+	below_hi := hi == nil || this.precedes(node.item, hi);
+	if above_lo {
+		this.iterate_range(node.left, lo, hi, it);
+	};
+	if above_lo && below_hi {
+		it.yield(node.item);
+	};
+	if below_hi {
+		this.iterate_range(node.right, lo, hi, it);
+	};
+};
+
+// An in order (or reverse order) walk of a tree that, unlike Iter(), doesn't
+// need a goroutine.
+type walker struct {
+	stack []*ll_rb_node;
+	reverse bool;
+};
+
+// Push node and its left (or, in reverse, right) descendants.
+func (this *walker) push(node *ll_rb_node) {
+	for node != nil {
+		this.stack = append(this.stack, node);
+		if this.reverse {
+			node = node.right;
+		} else {
+			node = node.left;
+		};
+	};
+};
+
+func new_walker(root *ll_rb_node) (w *walker) {
+	w = new(walker);
+	w.push(root);
+	return;
+};
+
+// Make a walk that starts at the first item that does not precede item or, if
+// reverse, that goes backwards from the last item that precedes item.
+func (this *Tree) new_walker_from(item Item, reverse bool) (w *walker) {
+	w = new(walker);
+	w.reverse = reverse;
+	for node := this.root; node != nil; {
+		if this.precedes(node.item, item) == reverse {
+			w.stack = append(w.stack, node);
+			if reverse {
+				node = node.right;
+			} else {
+				node = node.left;
+			};
+		} else if reverse {
+			node = node.left;
+		} else {
+			node = node.right;
+		};
+	};
+	return;
+};
+
+func (this *walker) next() (item Item, ok bool) {
+	top := len(this.stack) - 1;
+	if top < 0 {
+		return;
+	};
+	node := this.stack[top];
+	this.stack = this.stack[0:top];
+	if this.reverse {
+		this.push(node.left);
+	} else {
+		this.push(node.right);
+	};
+	return node.item, true;
 };
 
 func copy(node *ll_rb_node) *ll_rb_node {
@@ -229,6 +454,8 @@ func copy(node *ll_rb_node) *ll_rb_node {
 	clone := new(ll_rb_node);
 	clone.item = node.item;
 	clone.red = node.red;
+	clone.hash = node.hash;
+	clone.size = node.size;
 	clone.left = copy(node.left);
 	clone.right = copy(node.right);
 	return clone;
@@ -242,17 +469,31 @@ type Tree struct {
 	root *ll_rb_node;
 	count uint;
 	keep_duplicates bool;
+	// incremented whenever an item is added to or removed from the tree
+	mod_count uint;
+	// this tree's generation (see own())
+	gen uint;
+	// nil unless the tree was made by MakeHashed()
+	hasher HashFunc;
+	observers []registration;
+	last_observer_id uint;
+	// nil unless the tree is instrumented (see Instrument())
+	metrics *Metrics;
 };
 
 // Find an item in the tree.  Useful for look up tables.
 func (this *Tree) Find(item Item) (entry Item, found bool) {
-	if this.count == 0 {
-		return;
+	if this.metrics != nil {
+		atomic.AddUint64(&this.metrics.Finds, 1);
 	};
+	return this.find(item);
+};
+
+func (this *Tree) find(item Item) (entry Item, found bool) {
 	for node := this.root; node != nil && !found; {
-		if item.Precedes(node.item) {
+		if this.precedes(item, node.item) {
 			node = node.left;
-		} else if node.item.Precedes(item) {
+		} else if this.precedes(node.item, item) {
 			node = node.right;
 		} else {
 			entry = node.item;
@@ -262,33 +503,146 @@ func (this *Tree) Find(item Item) (entry Item, found bool) {
 	return;
 };
 
+// The rank (see select_rank()) of an instance of item in the tree.
+func (this *Tree) rank(item Item) (rank uint, found bool) {
+	for node := this.root; node != nil; {
+		if this.precedes(item, node.item) {
+			node = node.left;
+		} else if this.precedes(node.item, item) {
+			rank += size_of(node.left) + 1;
+			node = node.right;
+		} else {
+			return rank + size_of(node.left), true;
+		};
+	};
+	return;
+};
+
 // Insert item in the tree.  If the tree was initialized to filter out
 // duplicates the item being inserted will overwrite any equal item already
 // in the tree.  This allows the tree to be used as a look up table using
 // {key, value} item types where Precedes() ony uses the key.
 func (this *Tree) Insert(item Item) {
+	if this.metrics != nil {
+		atomic.AddUint64(&this.metrics.Inserts, 1);
+	};
 	if this.keep_duplicates {
-		this.root = insert_keep_duplicates(this.root, item);
+		this.root = this.insert_keep_duplicates(this.root, item);
 		this.count++;
+		this.mod_count++;
+		this.root.red = false;
+		this.notify(nil, item);
 	} else {
-		var inserted bool;
-		this.root, inserted = insert(this.root, item);
-		if inserted {
+		var old Item;
+		this.root, old = this.insert(this.root, item);
+		if old == nil {
 			this.count++;
+			this.mod_count++;
 		};
+		this.root.red = false;
+		this.notify(old, item);
 	};
-	this.root.red = false;
 };
 
 // Delete item from the tree. If item has duplicates in the tree only one will
-// be deleted.
+// be deleted.  Deleting an item that is not in the tree has no effect (and,
+// in particular, doesn't disturb iterations in progress).
 func (this *Tree) Delete(item Item) {
-	var deleted bool;
-	this.root, deleted = delete(this.root, item);
-	if deleted {
-		this.count--;
+	if this.metrics != nil {
+		atomic.AddUint64(&this.metrics.Deletes, 1);
+	};
+	rank, found := this.rank(item);
+	if !found {
+		return;
+	};
+	var deleted Item;
+	this.root, deleted = this.delete(this.root, rank);
+	if this.root != nil {
+		this.root.red = false;
+	};
+	this.count--;
+	this.mod_count++;
+	this.notify(deleted, nil);
+};
+
+// Floor returns the last item in the tree that does not follow item.  found
+// is false if there is no such item.
+func (this *Tree) Floor(item Item) (entry Item, found bool) {
+	if this.metrics != nil {
+		atomic.AddUint64(&this.metrics.Finds, 1);
+	};
+	for node := this.root; node != nil; {
+		if this.precedes(item, node.item) {
+			node = node.left;
+		} else {
+			entry, found = node.item, true;
+			node = node.right;
+		};
+	};
+	return;
+};
+
+// Ceiling returns the first item in the tree that does not precede item.
+// found is false if there is no such item.
+func (this *Tree) Ceiling(item Item) (entry Item, found bool) {
+	if this.metrics != nil {
+		atomic.AddUint64(&this.metrics.Finds, 1);
+	};
+	for node := this.root; node != nil; {
+		if this.precedes(node.item, item) {
+			node = node.right;
+		} else {
+			entry, found = node.item, true;
+			node = node.left;
+		};
+	};
+	return;
+};
+
+// Min returns the first item in the tree (as defined by Item.Precedes()).
+// found is false if the tree is empty.
+func (this *Tree) Min() (item Item, found bool) {
+	node := this.root;
+	if node == nil {
+		return;
+	};
+	for node.left != nil {
+		node = node.left;
 	};
-	this.root.red = false;
+	return node.item, true;
+};
+
+// Max returns the last item in the tree (as defined by Item.Precedes()).
+// found is false if the tree is empty.
+func (this *Tree) Max() (item Item, found bool) {
+	node := this.root;
+	if node == nil {
+		return;
+	};
+	for node.right != nil {
+		node = node.right;
+	};
+	return node.item, true;
+};
+
+// DeleteMin deletes the first item in the tree and returns it.  If it has
+// duplicates in the tree only one will be deleted.  found is false if the
+// tree is empty.
+func (this *Tree) DeleteMin() (item Item, found bool) {
+	if this.metrics != nil {
+		atomic.AddUint64(&this.metrics.Deletes, 1);
+	};
+	if item, found = this.Min(); !found {
+		return;
+	};
+	this.root = this.delete_left_most(this.root);
+	if this.root != nil {
+		this.root.red = false;
+	};
+	this.count--;
+	this.mod_count++;
+	this.notify(item, nil);
+	return;
 };
 
 // Iterate over the tree in the order specified:
@@ -296,9 +650,62 @@ func (this *Tree) Delete(item Item) {
 //	order == REVERSE_ORDER: in reverse order as defined by Item.Precedes()
 //	order == PRE_ORDER: in binary tree pre order
 //	order == POST_ORDER: in binary tree post order
+// Inserting or deleting items while an iteration is in progress causes the
+// iterating goroutine to panic with ErrModified rather than silently skip or
+// repeat items.  Detection is best effort: as the tree is walked concurrently
+// with the loop consuming the channel the item received immediately after the
+// modification may already be unreliable.  The panic occurs in the goroutine
+// that walks the tree, not in the loop consuming the channel, so the caller
+// can't recover() from it and it terminates the program.  Overwriting an
+// existing item with Insert() does not alter the structure of the tree and is
+// permitted.
 func (this *Tree) Iter(order int) <-chan Item {
 	c := make(chan Item);
-	go iterate(this.root, c, order);
+	go iterate(this.root, new_iterator(this, c), order);
+	return c;
+};
+
+// IterRange iterates in order over those items in the tree that do not
+// precede lo and that precede hi.  A nil lo or hi means that the range is
+// unbounded at that end.  Only the parts of the tree that overlap the range
+// are visited.  See Iter() regarding modification during iteration.
+func (this *Tree) IterRange(lo, hi Item) <-chan Item {
+	return this.IterRangeContext(nil, lo, hi);
+};
+
+// Canceller is implemented by anything that signals that an operation should
+// be abandoned by closing the channel returned by Done() (e.g. a
+// context.Context).
+type Canceller interface {
+	Done() <-chan struct{};
+};
+
+func new_cancellable_iterator(tree *Tree, ctx Canceller, c chan<- Item) (it *iterator) {
+	it = new_iterator(tree, c);
+	if ctx != nil {
+		it.done = ctx.Done();
+	};
+	return;
+};
+
+// IterContext is the same as Iter() except that the iteration is abandoned
+// (and the channel closed) as soon as ctx is cancelled so that the iterating
+// goroutine doesn't wait forever for a consumer that has gone away.  A nil
+// ctx is never cancelled.
+func (this *Tree) IterContext(ctx Canceller, order int) <-chan Item {
+	c := make(chan Item);
+	go iterate(this.root, new_cancellable_iterator(this, ctx, c), order);
+	return c;
+};
+
+// IterRangeContext is the same as IterRange() except that the iteration is
+// abandoned when ctx is cancelled.  See IterContext().
+func (this *Tree) IterRangeContext(ctx Canceller, lo, hi Item) <-chan Item {
+	c := make(chan Item);
+	go func(it *iterator) {
+		defer it.finish();
+		this.iterate_range(this.root, lo, hi, it);
+	}(new_cancellable_iterator(this, ctx, c));
 	return c;
 };
 
@@ -313,6 +720,7 @@ func Make(filtered bool) (tree *Tree) {
 // Make a copy of this tree.
 func (this *Tree) Copy() (tree *Tree) {
 	tree = Make(!this.keep_duplicates);
+	tree.hasher = this.hasher;
 	tree.root = copy(this.root);
 	tree.count = this.count;
 	return;
@@ -329,3 +737,43 @@ func (this *Tree) Has(item Item) (found bool) {
 	return;
 };
 
+// Equal returns true if treeA and treeB contain equal items (including the
+// same number of any duplicates).  Only Item.Precedes() is consulted (so that
+// Equal() agrees with Compare()) and the items are always examined: see
+// HashEqual() for an O(1) test for trees made by MakeHashed().
+func Equal(treeA, treeB *Tree) bool {
+	return treeA.count == treeB.count && Compare(treeA, treeB) == 0;
+};
+
+// Compare returns a negative number, zero or a positive number depending on
+// whether treeA comes before, is equal to or comes after treeB.  Trees are
+// compared lexicographically by their items in order with a tree whose items
+// are a prefix of the other's coming first.  The trees are walked side by side
+// (without goroutines) only as far as their first difference.  Each tree
+// counts (see Instrument()) the comparisons made by its own items.
+func Compare(treeA, treeB *Tree) int {
+	walkA, walkB := new_walker(treeA.root), new_walker(treeB.root);
+	for {
+		itemA, okA := walkA.next();
+		itemB, okB := walkB.next();
+		switch {
+		case !okA && !okB:
+			return 0;
+		case !okA:
+			return -1;
+		case !okB:
+			return 1;
+		case treeA.precedes(itemA, itemB):
+			return -1;
+		case treeB.precedes(itemB, itemA):
+			return 1;
+		};
+	};
+	return 0;
+};
+
+// Precedes implements Item.Precedes() for trees (using Compare()) so that
+// trees of trees are possible.
+func (this *Tree) Precedes(other interface{}) bool {
+	return Compare(this, other.(*Tree)) < 0;
+};
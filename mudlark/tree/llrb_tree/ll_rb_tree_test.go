@@ -22,11 +22,8 @@ func (r Real) Precedes(other interface{}) bool {
 	return float64(r) < float64(other.(Real));
 };
 
-func Equal(a, b Item) bool {
-	if a.Precedes(b) || b.Precedes(a) {
-		return true;
-	};
-	return true;
+func equal_items(a, b Item) bool {
+	return !a.Precedes(b) && !b.Precedes(a);
 };
 
 func print_node(node *ll_rb_node) {
@@ -96,7 +93,7 @@ func TestMakeinsert(t *testing.T) {
 				t.Errorf("Count unchanged (insert i): Expected %v got: %v", tsz + 1, tree.count);
 			};
 		};
-		if ientry, iin = tree.Find(iitem); !iin || !Equal(ientry, iitem) {
+		if ientry, iin = tree.Find(iitem); !iin || !equal_items(ientry, iitem) {
 			t.Errorf("Inserted %v not found", iitem);
 			failures++;
 		};
@@ -245,3 +242,342 @@ func TestKeyValueChange(t *testing.T) {
 	};
 };
 
+
+func TestIterModified(t *testing.T) {
+	tree := Make(true);
+	for i := 0; i < 100; i++ {
+		tree.Insert(Int(i));
+	};
+	it := new_iterator(tree, make(chan Item, 2));
+	it.yield(Int(0));
+	tree.Insert(Int(50));
+	it.yield(Int(1));
+	tree.Insert(Int(100));
+	defer func() {
+		if err := recover(); err != ErrModified {
+			t.Errorf("Expected panic %v: got %v", ErrModified, err);
+		};
+	}();
+	it.yield(Int(2));
+	t.Errorf("Insertion during iteration not detected");
+};
+
+func TestIterModifiedDelete(t *testing.T) {
+	tree := Make(false);
+	for i := 0; i < 100; i++ {
+		tree.Insert(Int(i % 10));
+	};
+	mod_count := tree.mod_count;
+	tree.Insert(Int(5));
+	if tree.mod_count == mod_count {
+		t.Errorf("Insertion of duplicate not counted as a modification");
+	};
+	it := new_iterator(tree, make(chan Item, 1));
+	tree.Delete(Int(5));
+	defer func() {
+		if err := recover(); err != ErrModified {
+			t.Errorf("Expected panic %v: got %v", ErrModified, err);
+		};
+	}();
+	it.yield(Int(0));
+	t.Errorf("Deletion during iteration not detected");
+};
+
+// Overwriting items doesn't change the tree's structure so it is allowed
+// while Iter() is in progress.
+func TestIterOverwrite(t *testing.T) {
+	tree := Make(true);
+	for i := 0; i < 100; i++ {
+		tree.Insert(key_value{i, i});
+	};
+	count := 0;
+	for item := range tree.Iter(IN_ORDER) {
+		kv := item.(key_value);
+		if kv.value != count {
+			t.Errorf("Expected value %v: got %v", count, kv.value);
+		};
+		tree.Insert(key_value{kv.key, -count});
+		count++;
+	};
+	if count != 100 {
+		t.Errorf("Expected 100 items: got %v", count);
+	};
+	for i := 0; i < 100; i++ {
+		if item, _ := tree.Find(key_value{i, 0}); item.(key_value).value != -i {
+			t.Errorf("Item %v not overwritten", i);
+		};
+	};
+};
+
+// Deleting items that aren't in the tree must neither disturb an iteration
+// nor be reported as a modification.
+func TestIterDeleteAbsent(t *testing.T) {
+	tree := Make(true);
+	for i := 0; i < 200; i += 2 {
+		tree.Insert(Int(i));
+	};
+	root := tree.root;
+	count := 0;
+	var last Item;
+	for item := range tree.Iter(IN_ORDER) {
+		if count > 0 && !last.Precedes(item) {
+			t.Errorf("Unexpected order: %v : %v", last, item);
+		};
+		for i := 1; i < 200; i += 2 {
+			tree.Delete(Int(i));
+		};
+		count++;
+		last = item;
+	};
+	if count != 100 {
+		t.Errorf("Expected 100 items: got %v", count);
+	};
+	if tree.root != root {
+		t.Errorf("Deleting absent items changed the tree");
+	};
+};
+
+func TestDelete(t *testing.T) {
+	tree := Make(true);
+	tree.Delete(Int(1));
+	for i := 0; i < 1000; i += 2 {
+		tree.Insert(Int(i));
+	};
+	for i := 1; i < 1000; i += 2 {
+		tree.Delete(Int(i));
+	};
+	if tree.Len() != 500 {
+		t.Errorf("Deleting absent items changed length: %v", tree.Len());
+	};
+	for i := 0; i < 1000; i += 2 {
+		tree.Delete(Int(i));
+		if tree.Has(Int(i)) {
+			t.Errorf("Deleted %v still found", i);
+		};
+	};
+	if tree.Len() != 0 || tree.root != nil {
+		t.Errorf("Expected empty tree: got %v items", tree.Len());
+	};
+};
+
+func TestDelete_keep_duplicates(t *testing.T) {
+	tree := Make(false);
+	counts := make([]uint, 10);
+	for i := 0; i < 2000; i++ {
+		n := rand.Intn(10);
+		tree.Insert(Int(n));
+		counts[n]++;
+		n = rand.Intn(10);
+		tree.Delete(Int(n));
+		if counts[n] > 0 {
+			counts[n]--;
+		};
+	};
+	var total uint;
+	for _, count := range counts {
+		total += count;
+	};
+	if tree.Len() != total {
+		t.Errorf("Expected length %v: got %v", total, tree.Len());
+	};
+	for item := range tree.Iter(IN_ORDER) {
+		counts[int(item.(Int))]--;
+	};
+	for n, count := range counts {
+		if count != 0 {
+			t.Errorf("Wrong number of %v: off by %v", n, count);
+		};
+	};
+	black_height(t, tree.root);
+};
+
+func TestIterRange(t *testing.T) {
+	tree := Make(false);
+	for i := 0; i < 100; i++ {
+		tree.Insert(Int(rand.Intn(50)));
+	};
+	check := func(lo, hi Item) {
+		var expected []Item;
+		for item := range tree.Iter(IN_ORDER) {
+			if (lo == nil || !item.Precedes(lo)) && (hi == nil || item.Precedes(hi)) {
+				expected = append(expected, item);
+			};
+		};
+		var got []Item;
+		for item := range tree.IterRange(lo, hi) {
+			got = append(got, item);
+		};
+		if !reflect.DeepEqual(expected, got) {
+			t.Errorf("Range [%v, %v): expected %v got %v", lo, hi, expected, got);
+		};
+	};
+	check(nil, nil);
+	check(Int(10), nil);
+	check(nil, Int(10));
+	check(Int(10), Int(20));
+	check(Int(20), Int(10));
+	check(Int(25), Int(26));
+};
+
+func TestDeleteMin(t *testing.T) {
+	tree := Make(false);
+	if _, found := tree.DeleteMin(); found {
+		t.Errorf("DeleteMin found an item in an empty tree");
+	};
+	for i := 0; i < 500; i++ {
+		tree.Insert(Int(rand.Intn(100)));
+	};
+	max, _ := tree.Max();
+	last := Int(-1);
+	for tree.Len() > 0 {
+		min, _ := tree.Min();
+		item, found := tree.DeleteMin();
+		if !found || item != min {
+			t.Errorf("DeleteMin returned %v: expected %v", item, min);
+		};
+		if item.Precedes(last) {
+			t.Errorf("DeleteMin returned %v after %v", item, last);
+		};
+		last = item.(Int);
+		black_height(t, tree.root);
+	};
+	if last != max {
+		t.Errorf("Last item deleted was %v: expected %v", last, max);
+	};
+	if tree.root != nil {
+		t.Errorf("Expected empty tree");
+	};
+};
+
+func TestFloorCeiling(t *testing.T) {
+	tree := Make(true);
+	if _, found := tree.Floor(Int(1)); found {
+		t.Errorf("Floor found an item in an empty tree");
+	};
+	for i := 10; i < 100; i += 10 {
+		tree.Insert(Int(i));
+	};
+	for i := 0; i < 110; i++ {
+		expected_floor, expected_ceiling := Int(i / 10 * 10), Int((i + 9) / 10 * 10);
+		if expected_floor > 90 {
+			expected_floor = 90;
+		};
+		if expected_ceiling < 10 {
+			expected_ceiling = 10;
+		};
+		floor, ffound := tree.Floor(Int(i));
+		if ffound != (i >= 10) || (ffound && floor != expected_floor) {
+			t.Errorf("Floor(%v): got %v %v", i, floor, ffound);
+		};
+		ceiling, cfound := tree.Ceiling(Int(i));
+		if cfound != (i <= 90) || (cfound && ceiling != expected_ceiling) {
+			t.Errorf("Ceiling(%v): got %v %v", i, ceiling, cfound);
+		};
+	};
+};
+
+func make_tree(items ...Item) (tree *Tree) {
+	tree = Make(false);
+	for _, item := range items {
+		tree.Insert(item);
+	};
+	return;
+};
+
+type compare_case struct {
+	a, b *Tree;
+	expected int;
+};
+
+func TestCompare(t *testing.T) {
+	cases := []compare_case{
+		compare_case{make_tree(), make_tree(), 0},
+		compare_case{make_tree(), make_tree(Int(1)), -1},
+		compare_case{make_tree(Int(2), Int(1)), make_tree(Int(1), Int(2)), 0},
+		compare_case{make_tree(Int(1), Int(2)), make_tree(Int(1), Int(3)), -1},
+		compare_case{make_tree(Int(1), Int(2), Int(3)), make_tree(Int(1), Int(2)), 1},
+		compare_case{make_tree(Int(2)), make_tree(Int(1), Int(3)), 1},
+		compare_case{make_tree(Int(1), Int(1)), make_tree(Int(1)), 1},
+	};
+	for _, c := range cases {
+		if got := Compare(c.a, c.b); got != c.expected {
+			t.Errorf("Compare(%v, %v): expected %v got %v", tree_items(c.a), tree_items(c.b), c.expected, got);
+		};
+		if got := Compare(c.b, c.a); got != -c.expected {
+			t.Errorf("Compare(%v, %v): expected %v got %v", tree_items(c.b), tree_items(c.a), -c.expected, got);
+		};
+		if Equal(c.a, c.b) != (c.expected == 0) {
+			t.Errorf("Equal(%v, %v) != %v", tree_items(c.a), tree_items(c.b), c.expected == 0);
+		};
+		if c.a.Precedes(c.b) != (c.expected < 0) {
+			t.Errorf("%v.Precedes(%v) != %v", tree_items(c.a), tree_items(c.b), c.expected < 0);
+		};
+	};
+};
+
+func TestTreeOfTrees(t *testing.T) {
+	trees := Make(true);
+	trees.Insert(make_tree(Int(2)));
+	trees.Insert(make_tree(Int(1), Int(5)));
+	trees.Insert(make_tree());
+	trees.Insert(make_tree(Int(5), Int(1)));
+	if trees.Len() != 3 {
+		t.Errorf("Expected 3 trees: got %v", trees.Len());
+	};
+	var got [][]Item;
+	for tree := range trees.Iter(IN_ORDER) {
+		got = append(got, tree_items(tree.(*Tree)));
+	};
+	if fmt.Sprint(got) != "[[] [1 5] [2]]" {
+		t.Errorf("Expected [[] [1 5] [2]]: got %v", got);
+	};
+};
+
+type canceller chan struct{};
+
+func (this canceller) Done() <-chan struct{} {
+	return this;
+};
+
+func TestIterContext(t *testing.T) {
+	tree := Make(true);
+	for i := 0; i < 1000; i++ {
+		tree.Insert(Int(i));
+	};
+	n := 0;
+	for _ = range tree.IterContext(nil, IN_ORDER) {
+		n++;
+	};
+	if n != 1000 {
+		t.Errorf("Expected 1000 items: got %v", n);
+	};
+	for _, order := range []int{PRE_ORDER, IN_ORDER, POST_ORDER, REVERSE_ORDER} {
+		ctx := make(canceller);
+		c := tree.IterContext(ctx, order);
+		for i := 0; i < 10; i++ {
+			<-c;
+		};
+		close(ctx);
+		// The channel must be closed after at most one more item.
+		n := 0;
+		for _ = range c {
+			n++;
+		};
+		if n > 1 {
+			t.Errorf("Iteration continued for %v items after cancellation", n);
+		};
+	};
+	ctx := make(canceller);
+	c := tree.IterRangeContext(ctx, Int(100), Int(200));
+	if item := <-c; item != Int(100) {
+		t.Errorf("Expected 100: got %v", item);
+	};
+	close(ctx);
+	n = 0;
+	for _ = range c {
+		n++;
+	};
+	if n > 1 {
+		t.Errorf("Range iteration continued for %v items after cancellation", n);
+	};
+};
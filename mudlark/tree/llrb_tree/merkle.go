@@ -0,0 +1,152 @@
+// Copyright 2010 -- Peter Williams, all rights reserved
+// Use of this source code is governed by the new BSD license.
+
+package llrb_tree;
+
+// HashFunc is the type of the functions used to hash the items in trees made
+// by MakeHashed().  Items that are equal (as defined by Item.Precedes()) but
+// differ in other respects (e.g. {key, value} items with different values)
+// should have different hashes.
+type HashFunc func(item Item) uint64;
+
+// Make a Tree in which each node caches a hash of its subtree so that trees
+// can be compared (see HashEqual()) and their differences found (see
+// Differences()) without examining all of their contents.  The parameter
+// "filtered" determines whether duplicate items will be filtered out (or
+// kept) during insertion.
+//
+// The hash of a subtree is the sum of the hashes of its items so that (unlike
+// the shape of the tree) it does not depend on the order in which the items
+// were inserted.
+func MakeHashed(filtered bool, hasher HashFunc) (tree *Tree) {
+	tree = Make(filtered);
+	tree.hasher = hasher;
+	return;
+};
+
+func hash_of(node *ll_rb_node) uint64 {
+	if node == nil {
+		return 0;
+	};
+	return node.hash;
+};
+
+func (this *Tree) rehash(node *ll_rb_node) {
+	if this.hasher != nil {
+		node.hash = this.hasher(node.item) + hash_of(node.left) + hash_of(node.right);
+	};
+};
+
+// HashEqual returns true if treeA and treeB have the same number of items and
+// the same hash which (as it takes O(1) time) is a cheap test for whether
+// they are probably equal.  A match only means "probably" because different
+// contents can have the same hash.  A mismatch means that the contents differ
+// although perhaps only in ways that Item.Precedes() ignores (so that Equal()
+// may still be true).  Both trees must have been made by MakeHashed() with the
+// same hash function: as functions can't be compared that is up to the
+// caller.  It is false if either tree isn't hashed.
+func HashEqual(treeA, treeB *Tree) bool {
+	if treeA.hasher == nil || treeB.hasher == nil {
+		return false;
+	};
+	return treeA.count == treeB.count && treeA.Hash() == treeB.Hash();
+};
+
+// Hash returns the hash of the tree's contents.  It is always 0 for trees
+// not made by MakeHashed().
+func (this *Tree) Hash() uint64 {
+	return hash_of(this.root);
+};
+
+// The sum of the hashes of the items that precede bound (or that do not
+// follow it if inclusive).
+func prefix_hash(node *ll_rb_node, bound Item, inclusive bool) (hash uint64) {
+	for node != nil {
+		var below bool;
+		if inclusive {
+			below = !bound.Precedes(node.item);
+		} else {
+			below = node.item.Precedes(bound);
+		};
+		if below {
+			hash += node.hash - hash_of(node.right);
+			node = node.right;
+		} else {
+			node = node.left;
+		};
+	};
+	return;
+};
+
+// The sum of the hashes of the items that follow lo and precede hi where nil
+// means unbounded.
+func range_hash(node *ll_rb_node, lo, hi Item) (hash uint64) {
+	if hi == nil {
+		hash = hash_of(node);
+	} else {
+		hash = prefix_hash(node, hi, false);
+	};
+	if lo != nil {
+		hash -= prefix_hash(node, lo, true);
+	};
+	return;
+};
+
+// The sum of the hashes of the items equal to item.
+func point_hash(node *ll_rb_node, item Item) uint64 {
+	return prefix_hash(node, item, true) - prefix_hash(node, item, false);
+};
+
+// The item closest to the root that follows lo and precedes hi.
+func pivot(node *ll_rb_node, lo, hi Item) Item {
+	for node != nil {
+		if lo != nil && !lo.Precedes(node.item) {
+			node = node.right;
+		} else if hi != nil && !node.item.Precedes(hi) {
+			node = node.left;
+		} else {
+			return node.item;
+		};
+	};
+	return nil;
+};
+
+// Mismatch describes an item that differs between two trees.  A and B are
+// the instances of the item in each tree with nil meaning that the tree
+// doesn't contain the item.
+type Mismatch struct {
+	A, B Item;
+};
+
+func differences(treeA, treeB *Tree, lo, hi Item, c chan<- Mismatch) {
+	if range_hash(treeA.root, lo, hi) == range_hash(treeB.root, lo, hi) {
+		return;
+	};
+	p := pivot(treeA.root, lo, hi);
+	if p == nil {
+		p = pivot(treeB.root, lo, hi);
+	};
+	differences(treeA, treeB, lo, p, c);
+	if point_hash(treeA.root, p) != point_hash(treeB.root, p) {
+		var d Mismatch;
+		d.A, _ = treeA.Find(p);
+		d.B, _ = treeB.Find(p);
+		c <- d;
+	};
+	differences(treeA, treeB, p, hi, c);
+};
+
+// Differences returns a channel that will emit (in order) each item that
+// differs between treeA and treeB.  Both trees must have been made by
+// MakeHashed() with the same hash function and only those ranges of items
+// whose hashes differ are examined so the cost is proportional to the number
+// of differences rather than to the size of the trees.  For trees that keep
+// duplicates an item whose duplicates differ is reported once.
+func Differences(treeA, treeB *Tree) <-chan Mismatch {
+	c := make(chan Mismatch);
+	go func() {
+		differences(treeA, treeB, nil, nil, c);
+		close(c);
+	}();
+	return c;
+};
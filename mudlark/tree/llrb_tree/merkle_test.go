@@ -0,0 +1,182 @@
+// Copyright 2010 -- Peter Williams, all rights reserved
+// Use of this source code is governed by the new BSD license.
+
+package llrb_tree;
+
+import (
+	"testing";
+	"rand";
+);
+
+func hash_key_value(item Item) uint64 {
+	var h uint64;
+	switch i := item.(type) {
+	case Int:
+		h = uint64(i);
+	case key_value:
+		h = uint64(i.key) * 31 + uint64(i.value);
+	};
+	// finalizer from MurmurHash3
+	h ^= h >> 33;
+	h *= 0xff51afd7ed558ccd;
+	h ^= h >> 33;
+	h *= 0xc4ceb93fe53e88b3;
+	h ^= h >> 33;
+	return h;
+};
+
+// Check that every node's cached hash is correct.
+func check_hashes(t *testing.T, node *ll_rb_node) uint64 {
+	if node == nil {
+		return 0;
+	};
+	hash := hash_key_value(node.item) + check_hashes(t, node.left) + check_hashes(t, node.right);
+	if hash != node.hash {
+		t.Errorf("Bad hash at %v: %v != %v", node.item, node.hash, hash);
+	};
+	return hash;
+};
+
+func TestHashShapeIndependent(t *testing.T) {
+	forward, backward := MakeHashed(true, hash_key_value), MakeHashed(true, hash_key_value);
+	for i := 0; i < 1000; i++ {
+		forward.Insert(Int(i));
+		backward.Insert(Int(999 - i));
+	};
+	if forward.Hash() != backward.Hash() {
+		t.Errorf("Hashes of equal trees differ: %v != %v", forward.Hash(), backward.Hash());
+	};
+	if !Equal(forward, backward) {
+		t.Errorf("Equal trees not equal");
+	};
+	forward.Delete(Int(500));
+	backward.Delete(Int(501));
+	if forward.Hash() == backward.Hash() || Equal(forward, backward) {
+		t.Errorf("Unequal trees equal");
+	};
+	check_hashes(t, forward.root);
+	check_hashes(t, backward.root);
+	if !Equal(forward, forward.Copy()) || forward.Copy().Hash() != forward.Hash() {
+		t.Errorf("Copy not equal");
+	};
+};
+
+func TestHashMaintained(t *testing.T) {
+	tree := MakeHashed(false, hash_key_value);
+	for i := 0; i < 2000; i++ {
+		tree.Insert(Int(rand.Intn(300)));
+		tree.Delete(Int(rand.Intn(300)));
+	};
+	check_hashes(t, tree.root);
+	txn := tree.Begin();
+	for i := 0; i < 500; i++ {
+		txn.Insert(Int(rand.Intn(300)));
+		txn.Delete(Int(rand.Intn(300)));
+	};
+	check_hashes(t, tree.root);
+	check_hashes(t, txn.view.root);
+	txn.Commit();
+	check_hashes(t, tree.root);
+};
+
+func TestEqualUnhashed(t *testing.T) {
+	treeA, treeB := Make(false), Make(false);
+	for i := 0; i < 100; i++ {
+		treeA.Insert(Int(i % 10));
+		treeB.Insert(Int(9 - i % 10));
+	};
+	if !Equal(treeA, treeB) {
+		t.Errorf("Equal trees not equal");
+	};
+	treeA.Delete(Int(3));
+	treeA.Insert(Int(4));
+	if Equal(treeA, treeB) {
+		t.Errorf("Unequal trees equal");
+	};
+};
+
+// A weak hash that makes collisions easy to arrange.
+func hash_sum(item Item) uint64 {
+	switch i := item.(type) {
+	case Int:
+		return uint64(i);
+	case key_value:
+		return uint64(i.key + i.value);
+	};
+	return 0;
+};
+
+func TestHashEqual(t *testing.T) {
+	treeA, treeB := MakeHashed(true, hash_sum), MakeHashed(true, hash_sum);
+	treeA.Insert(Int(1));
+	treeA.Insert(Int(4));
+	treeB.Insert(Int(2));
+	treeB.Insert(Int(3));
+	// a collision: the hashes only say that the trees are probably equal
+	if !HashEqual(treeA, treeB) || Equal(treeA, treeB) {
+		t.Errorf("Colliding trees: HashEqual() %v, Equal() %v", HashEqual(treeA, treeB), Equal(treeA, treeB));
+	};
+	// equal items (as far as Precedes() can tell) whose hashes differ
+	treeA, treeB = MakeHashed(true, hash_sum), MakeHashed(true, hash_sum);
+	treeA.Insert(key_value{1, 1});
+	treeA.Insert(key_value{2, 3});
+	treeB.Insert(key_value{1, 2});
+	treeB.Insert(key_value{2, 1});
+	if HashEqual(treeA, treeB) || !Equal(treeA, treeB) || Compare(treeA, treeB) != 0 {
+		t.Errorf("Trees differing in values: HashEqual() %v, Equal() %v", HashEqual(treeA, treeB), Equal(treeA, treeB));
+	};
+	// whether a tree is hashed makes no difference to Equal()
+	unhashed := Make(true);
+	for _, item := range tree_items(treeA) {
+		unhashed.Insert(item);
+	};
+	if !Equal(treeA, unhashed) || !Equal(unhashed, treeB) || HashEqual(treeA, unhashed) {
+		t.Errorf("Equal() depends on hashing");
+	};
+	if !HashEqual(treeA, treeA.Copy()) || HashEqual(unhashed, unhashed) {
+		t.Errorf("Unexpected HashEqual() of copies");
+	};
+};
+
+func TestDifferences(t *testing.T) {
+	treeA, treeB := MakeHashed(true, hash_key_value), MakeHashed(true, hash_key_value);
+	for i := 0; i < 1000; i++ {
+		kv := key_value{rand.Intn(2000), rand.Intn(3)};
+		treeA.Insert(kv);
+		treeB.Insert(kv);
+	};
+	if _, ok := <-Differences(treeA, treeB); ok {
+		t.Errorf("Equal trees have differences");
+	};
+	for i := 0; i < 20; i++ {
+		treeA.Insert(key_value{rand.Intn(2000), rand.Intn(3)});
+		treeB.Delete(key_value{rand.Intn(2000), 0});
+	};
+	expected := 0;
+	for i := 0; i < 2000; i++ {
+		a, foundA := treeA.Find(key_value{i, 0});
+		b, foundB := treeB.Find(key_value{i, 0});
+		if foundA != foundB || (foundA && a != b) {
+			expected++;
+		};
+	};
+	count := 0;
+	var last Item;
+	for d := range Differences(treeA, treeB) {
+		count++;
+		if d.A == d.B {
+			t.Errorf("Reported difference is the same: %v", d.A);
+		};
+		item := d.A;
+		if item == nil {
+			item = d.B;
+		};
+		if last != nil && !last.Precedes(item) {
+			t.Errorf("Differences out of order: %v, %v", last, item);
+		};
+		last = item;
+	};
+	if count != expected {
+		t.Errorf("Expected %v differences: got %v", expected, count);
+	};
+};
@@ -0,0 +1,76 @@
+// Copyright 2010 -- Peter Williams, all rights reserved
+// Use of this source code is governed by the new BSD license.
+
+package llrb_tree;
+
+import (
+	"fmt";
+	"sync/atomic";
+);
+
+// Metrics counts the operations performed on instrumented trees (see
+// Tree.Instrument()) and sets (see heteroset.Set.Instrument()) and the work
+// that they did.  Dividing the work counts by Operations() gives the average
+// cost of an operation.
+//
+// *Metrics implements expvar.Var (via String()) so that the counts can be
+// published with expvar.Publish().  The counters are updated (and read by
+// Operations() and String()) atomically so that they can be published while
+// the trees (or sets) are in use.  Code that reads the fields directly while
+// the trees are in use must use atomic.LoadUint64().
+type Metrics struct {
+	// calls to Insert(), Delete() (and DeleteMin()) and Find() (and Has(),
+	// Floor() and Ceiling()) or to a set's Add(), Remove() and Find()
+	Inserts, Deletes, Finds uint64;
+	// calls to Item.Precedes() made by the above and by IterRange(),
+	// Nearest() and Compare() (and Equal())
+	Comparisons uint64;
+	RotateLefts, RotateRights uint64;
+	FlipColours uint64;
+	MoveRedLefts, MoveRedRights uint64;
+};
+
+// Instrument makes the tree count its operations in metrics (which may be
+// shared by several trees).  A nil metrics turns instrumentation off.  Trees
+// that aren't instrumented don't incur the cost of counting.
+func (this *Tree) Instrument(metrics *Metrics) {
+	this.metrics = metrics;
+};
+
+func (this *Tree) precedes(a, b Item) bool {
+	if this.metrics != nil {
+		atomic.AddUint64(&this.metrics.Comparisons, 1);
+	};
+	return a.Precedes(b);
+};
+
+// Operations returns the total number of operations counted.
+func (this *Metrics) Operations() uint64 {
+	return atomic.LoadUint64(&this.Inserts) + atomic.LoadUint64(&this.Deletes) +
+		atomic.LoadUint64(&this.Finds);
+};
+
+func (this *Metrics) counters() []*uint64 {
+	return []*uint64{&this.Inserts, &this.Deletes, &this.Finds, &this.Comparisons,
+		&this.RotateLefts, &this.RotateRights, &this.FlipColours,
+		&this.MoveRedLefts, &this.MoveRedRights};
+};
+
+// Reset sets all of the counts to zero.
+func (this *Metrics) Reset() {
+	for _, counter := range this.counters() {
+		atomic.StoreUint64(counter, 0);
+	};
+};
+
+// String returns the counts as a JSON object.
+func (this *Metrics) String() string {
+	counters := this.counters();
+	counts := make([]interface{}, len(counters));
+	for i, counter := range counters {
+		counts[i] = atomic.LoadUint64(counter);
+	};
+	return fmt.Sprintf("{\"Inserts\": %d, \"Deletes\": %d, \"Finds\": %d, \"Comparisons\": %d, " +
+		"\"RotateLefts\": %d, \"RotateRights\": %d, \"FlipColours\": %d, " +
+		"\"MoveRedLefts\": %d, \"MoveRedRights\": %d}", counts...);
+};
@@ -0,0 +1,110 @@
+// Copyright 2010 -- Peter Williams, all rights reserved
+// Use of this source code is governed by the new BSD license.
+
+package llrb_tree;
+
+import (
+	"testing";
+	"expvar";
+	"math";
+	"rand";
+);
+
+type counted_int struct {
+	value int;
+	count *uint64;
+};
+
+func (this counted_int) Precedes(other interface{}) bool {
+	*this.count++;
+	return this.value < other.(counted_int).value;
+};
+
+func TestMetrics(t *testing.T) {
+	var metrics Metrics;
+	var comparisons uint64;
+	tree := Make(true);
+	tree.Instrument(&metrics);
+	for i := 0; i < 1000; i++ {
+		tree.Insert(counted_int{rand.Intn(500), &comparisons});
+	};
+	for i := 0; i < 100; i++ {
+		tree.Delete(counted_int{rand.Intn(500), &comparisons});
+		tree.Has(counted_int{rand.Intn(500), &comparisons});
+	};
+	if metrics.Inserts != 1000 || metrics.Deletes != 100 || metrics.Finds != 100 || metrics.Operations() != 1200 {
+		t.Errorf("Wrong operation counts: %v", metrics.String());
+	};
+	if metrics.Comparisons != comparisons {
+		t.Errorf("Expected %v comparisons: got %v", comparisons, metrics.Comparisons);
+	};
+	if metrics.RotateLefts == 0 || metrics.RotateRights == 0 || metrics.FlipColours == 0 || metrics.MoveRedLefts == 0 || metrics.MoveRedRights == 0 {
+		t.Errorf("Expected structural changes: %v", metrics.String());
+	};
+	for _ = range tree.IterRange(counted_int{100, &comparisons}, counted_int{200, &comparisons}) {
+	};
+	tree.Nearest(counted_int{250, &comparisons}, 5, func(a, b Item) float64 {
+		return math.Fabs(float64(a.(counted_int).value - b.(counted_int).value));
+	});
+	Equal(tree, tree);
+	if metrics.Comparisons != comparisons {
+		t.Errorf("Expected %v comparisons after ranges: got %v", comparisons, metrics.Comparisons);
+	};
+	tree.Instrument(nil);
+	before := metrics;
+	tree.Insert(counted_int{1000, &comparisons});
+	if metrics != before {
+		t.Errorf("Uninstrumented tree updated metrics");
+	};
+	metrics.Reset();
+	if metrics.Operations() != 0 || metrics.Comparisons != 0 {
+		t.Errorf("Reset failed: %v", metrics.String());
+	};
+};
+
+func TestMetricsTransaction(t *testing.T) {
+	var metrics Metrics;
+	tree := Make(true);
+	tree.Instrument(&metrics);
+	txn := tree.Begin();
+	txn.Insert(Int(1));
+	txn.Insert(Int(2));
+	txn.Commit();
+	if metrics.Inserts != 2 {
+		t.Errorf("Expected 2 inserts: got %v", metrics.Inserts);
+	};
+};
+
+func TestMetricsExpvar(t *testing.T) {
+	metrics := new(Metrics);
+	expvar.Publish("llrb_tree_test_metrics", metrics);
+	metrics.Inserts = 3;
+	metrics.Comparisons = 7;
+	got := expvar.Get("llrb_tree_test_metrics").String();
+	expected := "{\"Inserts\": 3, \"Deletes\": 0, \"Finds\": 0, \"Comparisons\": 7, \"RotateLefts\": 0, \"RotateRights\": 0, \"FlipColours\": 0, \"MoveRedLefts\": 0, \"MoveRedRights\": 0}";
+	if got != expected {
+		t.Errorf("Expected %v: got %v", expected, got);
+	};
+};
+
+func TestMetricsConcurrentString(t *testing.T) {
+	metrics := new(Metrics);
+	tree := Make(true);
+	tree.Instrument(metrics);
+	done := make(chan bool);
+	go func() {
+		for i := 0; i < 1000; i++ {
+			tree.Insert(Int(i));
+		};
+		done <- true;
+	}();
+	for i := 0; i < 100; i++ {
+		if metrics.String() == "" {
+			t.Fatalf("Empty metrics");
+		};
+	};
+	<-done;
+	if metrics.Inserts != 1000 {
+		t.Errorf("Expected 1000 inserts: got %v", metrics.String());
+	};
+};
@@ -0,0 +1,45 @@
+// Copyright 2010 -- Peter Williams, all rights reserved
+// Use of this source code is governed by the new BSD license.
+
+package llrb_tree;
+
+// DistanceFunc is the type of the functions used by Nearest() to measure how
+// far apart two items are.
+type DistanceFunc func(a, b Item) float64;
+
+// Nearest returns (up to) k items in the tree that are closest to item in
+// order of increasing distance.  The distance function must agree with the
+// ordering of the items: moving away from item in either direction must never
+// bring an item closer to it (which is the case for items keyed by numbers or
+// times and the absolute difference of their keys).  Of two items at the
+// same distance the one that comes first in the tree is returned first.
+//
+// The search starts from the positions of Floor(item) and Ceiling(item) and
+// works outwards in both directions so only O(k + log N) nodes are visited.
+func (this *Tree) Nearest(item Item, k uint, distance DistanceFunc) (items []Item) {
+	below := this.new_walker_from(item, true);
+	above := this.new_walker_from(item, false);
+	lo, lo_ok := below.next();
+	hi, hi_ok := above.next();
+	var lo_distance, hi_distance float64;
+	if lo_ok {
+		lo_distance = distance(item, lo);
+	};
+	if hi_ok {
+		hi_distance = distance(item, hi);
+	};
+	for uint(len(items)) < k && (lo_ok || hi_ok) {
+		if lo_ok && (!hi_ok || lo_distance <= hi_distance) {
+			items = append(items, lo);
+			if lo, lo_ok = below.next(); lo_ok {
+				lo_distance = distance(item, lo);
+			};
+		} else {
+			items = append(items, hi);
+			if hi, hi_ok = above.next(); hi_ok {
+				hi_distance = distance(item, hi);
+			};
+		};
+	};
+	return;
+};
@@ -0,0 +1,72 @@
+// Copyright 2010 -- Peter Williams, all rights reserved
+// Use of this source code is governed by the new BSD license.
+
+package llrb_tree;
+
+import (
+	"testing";
+	"rand";
+);
+
+func int_distance(a, b Item) float64 {
+	d := int(a.(Int)) - int(b.(Int));
+	if d < 0 {
+		d = -d;
+	};
+	return float64(d);
+};
+
+func check_nearest(t *testing.T, tree *Tree, item Item, k uint) {
+	nearest := tree.Nearest(item, k, int_distance);
+	expected := k;
+	if tree.Len() < k {
+		expected = tree.Len();
+	};
+	if uint(len(nearest)) != expected {
+		t.Errorf("Nearest(%v, %v): expected %v items: got %v", item, k, expected, len(nearest));
+		return;
+	};
+	// Every item left out must be at least as far away as those returned.
+	remaining := make(map[Int]int);
+	for i := range tree.Iter(IN_ORDER) {
+		remaining[i.(Int)]++;
+	};
+	furthest := 0.0;
+	for _, i := range nearest {
+		d := int_distance(item, i);
+		if d < furthest {
+			t.Errorf("Nearest(%v, %v): %v out of order", item, k, i);
+		};
+		furthest = d;
+		remaining[i.(Int)]--;
+	};
+	for i, n := range remaining {
+		if n < 0 {
+			t.Errorf("Nearest(%v, %v): %v returned too often", item, k, i);
+		} else if n > 0 && int_distance(item, i) < furthest {
+			t.Errorf("Nearest(%v, %v): missed %v", item, k, i);
+		};
+	};
+};
+
+func TestNearest(t *testing.T) {
+	tree := Make(false);
+	if items := tree.Nearest(Int(1), 3, int_distance); len(items) != 0 {
+		t.Errorf("Found %v in empty tree", items);
+	};
+	for i := 0; i < 200; i++ {
+		tree.Insert(Int(rand.Intn(1000)));
+	};
+	for i := 0; i < 50; i++ {
+		check_nearest(t, tree, Int(rand.Intn(1200) - 100), uint(rand.Intn(20)));
+	};
+	check_nearest(t, tree, Int(500), 1000);
+	tree = Make(true);
+	for i := 0; i < 10; i += 2 {
+		tree.Insert(Int(i));
+	};
+	items := tree.Nearest(Int(5), 3, int_distance);
+	if len(items) != 3 || items[0] != Int(4) || items[1] != Int(6) || items[2] != Int(2) {
+		t.Errorf("Expected [4 6 2]: got %v", items);
+	};
+};
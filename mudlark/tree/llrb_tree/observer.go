@@ -0,0 +1,85 @@
+// Copyright 2010 -- Peter Williams, all rights reserved
+// Use of this source code is governed by the new BSD license.
+
+package llrb_tree;
+
+// Observer is the interface that must be implemented by objects that wish to
+// be notified of changes to the contents of a Tree (e.g. in order to maintain
+// caches, counters or secondary indexes derived from those contents).
+// Notifications are made after the tree has been changed.
+type Observer interface {
+	// item has been added to the tree.
+	Inserted(item Item);
+	// old has been replaced by new (which is equal to it) because the tree
+	// filters out duplicates.
+	Overwritten(old, new Item);
+	// item has been removed from the tree.
+	Deleted(item Item);
+};
+
+type registration struct {
+	id uint;
+	observer Observer;
+};
+
+// AddObserver registers observer to be notified of changes to the tree's
+// contents.  The returned id can be used to unregister it with
+// RemoveObserver().  Observers are notified in the order that they were
+// added.
+func (this *Tree) AddObserver(observer Observer) (id uint) {
+	this.last_observer_id++;
+	id = this.last_observer_id;
+	this.observers = append(this.observers, registration{id, observer});
+	return;
+};
+
+// RemoveObserver unregisters the observer with the given id.
+func (this *Tree) RemoveObserver(id uint) {
+	for i, r := range this.observers {
+		if r.id == id {
+			// Don't modify the slice in place as notify() may be
+			// ranging over it.
+			observers := make([]registration, 0, len(this.observers) - 1);
+			observers = append(observers, this.observers[0:i]...);
+			this.observers = append(observers, this.observers[i + 1:]...);
+			return;
+		};
+	};
+};
+
+// Notify the observers of a change: old is nil for insertions and new is nil
+// for deletions.
+func (this *Tree) notify(old, new Item) {
+	for _, r := range this.observers {
+		switch {
+		case old == nil:
+			r.observer.Inserted(new);
+		case new == nil:
+			r.observer.Deleted(old);
+		default:
+			r.observer.Overwritten(old, new);
+		};
+	};
+};
+
+// Records the changes made by a transaction so that the tree's observers can
+// be notified of them when it is committed.
+type recorder struct {
+	changes []change;
+};
+
+type change struct {
+	old, new Item;
+};
+
+func (this *recorder) Inserted(item Item) {
+	this.changes = append(this.changes, change{nil, item});
+};
+
+func (this *recorder) Overwritten(old, new Item) {
+	this.changes = append(this.changes, change{old, new});
+};
+
+func (this *recorder) Deleted(item Item) {
+	this.changes = append(this.changes, change{item, nil});
+};
@@ -0,0 +1,99 @@
+// Copyright 2010 -- Peter Williams, all rights reserved
+// Use of this source code is governed by the new BSD license.
+
+package llrb_tree;
+
+import "testing";
+
+type event struct {
+	old, new Item;
+};
+
+type event_log struct {
+	events []event;
+};
+
+func (this *event_log) Inserted(item Item) {
+	this.events = append(this.events, event{nil, item});
+};
+
+func (this *event_log) Overwritten(old, new Item) {
+	this.events = append(this.events, event{old, new});
+};
+
+func (this *event_log) Deleted(item Item) {
+	this.events = append(this.events, event{item, nil});
+};
+
+func (this *event_log) check(t *testing.T, expected ...event) {
+	if len(this.events) != len(expected) {
+		t.Errorf("Expected %v events: got %v", expected, this.events);
+		return;
+	};
+	for i, e := range expected {
+		if this.events[i] != e {
+			t.Errorf("Event %v: expected %v got %v", i, e, this.events[i]);
+		};
+	};
+	this.events = nil;
+};
+
+func TestObservers(t *testing.T) {
+	tree := Make(true);
+	logA, logB := new(event_log), new(event_log);
+	idA := tree.AddObserver(logA);
+	tree.AddObserver(logB);
+	tree.Insert(key_value{1, 10});
+	tree.Insert(key_value{2, 20});
+	tree.Insert(key_value{1, 11});
+	tree.Delete(key_value{2, 0});
+	tree.Delete(key_value{3, 0});
+	expected := []event{
+		event{nil, key_value{1, 10}},
+		event{nil, key_value{2, 20}},
+		event{key_value{1, 10}, key_value{1, 11}},
+		event{key_value{2, 20}, nil},
+	};
+	logA.check(t, expected...);
+	logB.check(t, expected...);
+	tree.RemoveObserver(idA);
+	tree.Delete(key_value{1, 0});
+	logA.check(t);
+	logB.check(t, event{key_value{1, 11}, nil});
+};
+
+func TestObservers_keep_duplicates(t *testing.T) {
+	tree := Make(false);
+	log := new(event_log);
+	tree.AddObserver(log);
+	tree.Insert(Int(1));
+	tree.Insert(Int(1));
+	tree.Delete(Int(1));
+	log.check(t, event{nil, Int(1)}, event{nil, Int(1)}, event{Int(1), nil});
+};
+
+func TestObserversTransaction(t *testing.T) {
+	tree := Make(true);
+	log := new(event_log);
+	tree.AddObserver(log);
+	tree.Insert(Int(1));
+	log.check(t, event{nil, Int(1)});
+	txn := tree.Begin();
+	txn.Insert(Int(2));
+	txn.Delete(Int(1));
+	log.check(t);
+	txn.Commit();
+	log.check(t, event{nil, Int(2)}, event{Int(1), nil});
+	txn = tree.Begin();
+	txn.Insert(Int(3));
+	txn.Rollback();
+	log.check(t);
+	txn = tree.Begin();
+	txn.Insert(Int(4));
+	tree.Insert(Int(5));
+	log.check(t, event{nil, Int(5)});
+	if txn.Commit() != ErrConflict {
+		t.Errorf("Expected conflict");
+	};
+	log.check(t);
+};
@@ -0,0 +1,63 @@
+// Copyright 2010 -- Peter Williams, all rights reserved
+// Use of this source code is governed by the new BSD license.
+
+package llrb_tree;
+
+import "math";
+
+// The rank of the item at position x (counting from 1) of n items (n > 0)
+// where x is in [0, n] but may be inexact (e.g. 0.07 * 100 is
+// 7.000000000000001) so is rounded to the nearest whole number if it's within
+// rounding error of one before being rounded up.
+func position_rank(x float64, n uint) uint {
+	if whole := math.Floor(x + 0.5); math.Fabs(x - whole) <= 1e-9 * whole {
+		x = whole;
+	};
+	return clamp_rank(uint(math.Ceil(x)), n);
+};
+
+func clamp_rank(position, n uint) uint {
+	if position > n {
+		position = n;
+	};
+	if position > 0 {
+		position--;
+	};
+	return position;
+};
+
+// Quantile returns the item at fraction q (0 <= q <= 1) of the way through
+// the tree's items in order (with duplicates counted separately) in O(log N)
+// time.  The nearest rank definition is used so the item returned is always
+// one of those in the tree: the first for q == 0, the last for q == 1 and the
+// median (or the lower of the two middle items) for q == 0.5.  found is false
+// if the tree is empty or q is outside [0, 1].
+func (this *Tree) Quantile(q float64) (item Item, found bool) {
+	if this.count == 0 || !(q >= 0 && q <= 1) {
+		return;
+	};
+	return select_rank(this.root, position_rank(q * float64(this.count), this.count)), true;
+};
+
+// Percentiles returns the item at each of the percentiles ps (where the 99th
+// percentile is 99 and 0 <= p <= 100) in O(log N) time each.  See Quantile().
+// The result has an entry for each of ps that is nil if the tree is empty or
+// the percentile is out of range.  Whole numbered percentiles are located
+// using integer arithmetic so they are exact.
+func (this *Tree) Percentiles(ps []float64) (items []Item) {
+	items = make([]Item, len(ps));
+	n := this.count;
+	for i, p := range ps {
+		if n == 0 || !(p >= 0 && p <= 100) {
+			continue;
+		};
+		var rank uint;
+		if p == math.Floor(p) {
+			rank = clamp_rank((uint(p) * n + 99) / 100, n);
+		} else {
+			rank = position_rank(p * float64(n) / 100, n);
+		};
+		items[i] = select_rank(this.root, rank);
+	};
+	return;
+};
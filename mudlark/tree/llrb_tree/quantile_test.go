@@ -0,0 +1,115 @@
+// Copyright 2010 -- Peter Williams, all rights reserved
+// Use of this source code is governed by the new BSD license.
+
+package llrb_tree;
+
+import (
+	"testing";
+	"math";
+	"rand";
+);
+
+type percentile_case struct {
+	n int;
+	p float64;
+	index int;
+};
+
+func TestQuantile(t *testing.T) {
+	tree := Make(false);
+	if _, found := tree.Quantile(0.5); found {
+		t.Errorf("Quantile() of empty tree found an item");
+	};
+	if items := tree.Percentiles([]float64{50}); len(items) != 1 || items[0] != nil {
+		t.Errorf("Percentiles() of empty tree: got %v", items);
+	};
+	for i := 0; i < 1001; i++ {
+		tree.Insert(Int(rand.Intn(100)));
+	};
+	sorted := tree_items(tree);
+	n := len(sorted);
+	var metrics Metrics;
+	tree.Instrument(&metrics);
+	for i := 0; i <= 1000; i++ {
+		// the smallest position (counting from 1) that is at least
+		// i / 1000 of the way through
+		index := (i * n + 999) / 1000 - 1;
+		if index < 0 {
+			index = 0;
+		};
+		q := float64(i) / 1000;
+		if item, found := tree.Quantile(q); !found || item != sorted[index] {
+			t.Errorf("Quantile(%v): expected %v: got %v, %v", q, sorted[index], item, found);
+		};
+	};
+	if metrics.Comparisons != 0 {
+		t.Errorf("Quantile() made %v comparisons", metrics.Comparisons);
+	};
+	if item, _ := tree.Quantile(0); item != sorted[0] {
+		t.Errorf("Expected minimum %v: got %v", sorted[0], item);
+	};
+	if item, _ := tree.Quantile(0.5); item != sorted[n / 2] {
+		t.Errorf("Expected median %v: got %v", sorted[n / 2], item);
+	};
+	if item, _ := tree.Quantile(1); item != sorted[n - 1] {
+		t.Errorf("Expected maximum %v: got %v", sorted[n - 1], item);
+	};
+	for _, q := range []float64{-0.1, 1.1, math.NaN()} {
+		if _, found := tree.Quantile(q); found {
+			t.Errorf("Quantile(%v) found an item", q);
+		};
+	};
+	items := tree.Percentiles([]float64{50, 90, 99, 101});
+	for i, q := range []float64{0.5, 0.9, 0.99} {
+		if expected, _ := tree.Quantile(q); items[i] != expected {
+			t.Errorf("Percentile %v: expected %v: got %v", 100 * q, expected, items[i]);
+		};
+	};
+	if items[3] != nil {
+		t.Errorf("Expected nil for out of range percentile: got %v", items[3]);
+	};
+	// duplicates count separately
+	tree = make_tree(Int(1), Int(2), Int(2), Int(2), Int(3));
+	for q, expected := range map[float64]Int{0.2: 1, 0.21: 2, 0.8: 2, 0.81: 3} {
+		if item, _ := tree.Quantile(q); item != expected {
+			t.Errorf("Quantile(%v): expected %v: got %v", q, expected, item);
+		};
+	};
+	// positions that floating point arithmetic gets slightly wrong (e.g.
+	// 0.07 * 100 == 7.000000000000001)
+	cases := []percentile_case{
+		percentile_case{100, 0, 0},
+		percentile_case{100, 1, 0},
+		percentile_case{100, 7, 6},
+		percentile_case{100, 14, 13},
+		percentile_case{100, 28, 27},
+		percentile_case{100, 55, 54},
+		percentile_case{100, 56, 55},
+		percentile_case{100, 99, 98},
+		percentile_case{100, 100, 99},
+		percentile_case{100, 99.9, 99},
+		percentile_case{100, 0.5, 0},
+		percentile_case{50, 7, 3},
+		percentile_case{50, 14, 6},
+		percentile_case{50, 28, 13},
+		percentile_case{50, 56, 27},
+		percentile_case{50, 58, 28},
+		percentile_case{200, 7, 13},
+		percentile_case{200, 14, 27},
+		percentile_case{200, 28, 55},
+		percentile_case{200, 56, 111},
+		percentile_case{200, 57.5, 114},
+	};
+	for _, c := range cases {
+		tree = Make(true);
+		for i := 0; i < c.n; i++ {
+			tree.Insert(Int(i));
+		};
+		if items := tree.Percentiles([]float64{c.p}); items[0] != Int(c.index) {
+			t.Errorf("Percentile %v of %v: expected %v: got %v", c.p, c.n, c.index, items[0]);
+		};
+		if item, _ := tree.Quantile(c.p / 100); item != Int(c.index) {
+			t.Errorf("Quantile(%v) of %v: expected %v: got %v", c.p / 100, c.n, c.index, item);
+		};
+	};
+};
@@ -0,0 +1,63 @@
+// Copyright 2010 -- Peter Williams, all rights reserved
+// Use of this source code is governed by the new BSD license.
+
+package llrb_tree;
+
+// Source is the source of randomness used by Sample() and SampleK().  It is
+// satisfied by *rand.Rand so a seeded generator (e.g.
+// rand.New(rand.NewSource(seed))) can be used to make samples reproducible.
+type Source interface {
+	// return a uniformly distributed number in [0, n)
+	Int63n(n int64) int64;
+};
+
+// Return the item with the given rank (i.e. the number of items that come
+// before it in the tree) in the subtree.  rank must be less than its size.
+func select_rank(node *ll_rb_node, rank uint) Item {
+	for {
+		left := size_of(node.left);
+		switch {
+		case rank < left:
+			node = node.left;
+		case rank > left:
+			rank -= left + 1;
+			node = node.right;
+		default:
+			return node.item;
+		};
+	};
+	return nil;
+};
+
+// Sample returns an item chosen uniformly at random from the tree (counting
+// duplicates separately) in O(log N) time.  found is false if the tree is
+// empty.
+func (this *Tree) Sample(rng Source) (item Item, found bool) {
+	if this.count == 0 {
+		return;
+	};
+	return select_rank(this.root, uint(rng.Int63n(int64(this.count)))), true;
+};
+
+// SampleK returns k items chosen uniformly at random from the tree without
+// replacement (or all of the items if there are fewer than k) in O(k log N)
+// time.  Every subset of k items is equally likely but the order in which
+// they are returned is not random.
+func (this *Tree) SampleK(k uint, rng Source) (items []Item) {
+	n := this.count;
+	if k > n {
+		k = n;
+	};
+	items = make([]Item, 0, k);
+	// Robert Floyd's algorithm for choosing k distinct ranks
+	chosen := make(map[uint]bool, k);
+	for j := n - k; j < n; j++ {
+		rank := uint(rng.Int63n(int64(j) + 1));
+		if chosen[rank] {
+			rank = j;
+		};
+		chosen[rank] = true;
+		items = append(items, select_rank(this.root, rank));
+	};
+	return;
+};
@@ -0,0 +1,134 @@
+// Copyright 2010 -- Peter Williams, all rights reserved
+// Use of this source code is governed by the new BSD license.
+
+package llrb_tree;
+
+import (
+	"testing";
+	"rand";
+);
+
+func check_sizes(t *testing.T, node *ll_rb_node) uint {
+	if node == nil {
+		return 0;
+	};
+	size := check_sizes(t, node.left) + check_sizes(t, node.right) + 1;
+	if size != node.size {
+		t.Errorf("Bad size at %v: %v != %v", node.item, node.size, size);
+	};
+	return size;
+};
+
+func TestSizes(t *testing.T) {
+	tree := Make(false);
+	for i := 0; i < 2000; i++ {
+		tree.Insert(Int(rand.Intn(500)));
+	};
+	for i := 0; i < 1000; i++ {
+		tree.Delete(Int(rand.Intn(500)));
+	};
+	tree.DeleteMin();
+	if size := check_sizes(t, tree.root); size != tree.Len() {
+		t.Errorf("Expected root size %v: got %v", tree.Len(), size);
+	};
+	txn := tree.Begin();
+	for i := 0; i < 100; i++ {
+		txn.Insert(Int(rand.Intn(500)));
+		txn.Delete(Int(rand.Intn(500)));
+	};
+	check_sizes(t, tree.root);
+	check_sizes(t, txn.view.root);
+	check_sizes(t, tree.Copy().root);
+	// InsertNear() must update the sizes of all of the new node's ancestors
+	tree = Make(true);
+	var cursor *Cursor;
+	for i := 0; i < 1000; i++ {
+		cursor = tree.InsertNear(cursor, Int(i));
+	};
+	if size := check_sizes(t, tree.root); size != 1000 {
+		t.Errorf("Expected root size 1000: got %v", size);
+	};
+	if item, _ := tree.Quantile(1); item != Int(999) {
+		t.Errorf("Expected maximum 999: got %v", item);
+	};
+};
+
+func TestSample(t *testing.T) {
+	const sz = 10;
+	const samples = 10000;
+	tree := Make(false);
+	if _, found := tree.Sample(rand.New(rand.NewSource(1))); found {
+		t.Errorf("Sample() of empty tree found an item");
+	};
+	// duplicates count separately so 0 should be sampled twice as often
+	tree.Insert(Int(0));
+	for i := 0; i < sz; i++ {
+		tree.Insert(Int(i));
+	};
+	counts := make([]int, sz);
+	rng := rand.New(rand.NewSource(42));
+	for i := 0; i < samples; i++ {
+		item, found := tree.Sample(rng);
+		if !found {
+			t.Fatalf("Sample() found nothing");
+		};
+		counts[int(item.(Int))]++;
+	};
+	expected := samples / (sz + 1);
+	for i, count := range counts {
+		want := expected;
+		if i == 0 {
+			want = 2 * expected;
+		};
+		if count < want * 8 / 10 || count > want * 12 / 10 {
+			t.Errorf("%v sampled %v times: expected about %v", i, count, want);
+		};
+	};
+	// the same seed gives the same samples
+	rngA, rngB := rand.New(rand.NewSource(7)), rand.New(rand.NewSource(7));
+	for i := 0; i < 100; i++ {
+		a, _ := tree.Sample(rngA);
+		b, _ := tree.Sample(rngB);
+		if a != b {
+			t.Errorf("Samples with same seed differ: %v != %v", a, b);
+		};
+	};
+};
+
+func TestSampleK(t *testing.T) {
+	const sz = 20;
+	const k = 5;
+	const trials = 4000;
+	tree := Make(true);
+	for i := 0; i < sz; i++ {
+		tree.Insert(Int(i));
+	};
+	rng := rand.New(rand.NewSource(42));
+	counts := make([]int, sz);
+	for i := 0; i < trials; i++ {
+		items := tree.SampleK(k, rng);
+		if len(items) != k {
+			t.Fatalf("Expected %v items: got %v", k, len(items));
+		};
+		seen := make(map[Item]bool);
+		for _, item := range items {
+			if seen[item] {
+				t.Errorf("%v sampled twice in %v", item, items);
+			};
+			seen[item] = true;
+			counts[int(item.(Int))]++;
+		};
+	};
+	expected := trials * k / sz;
+	for i, count := range counts {
+		if count < expected * 8 / 10 || count > expected * 12 / 10 {
+			t.Errorf("%v sampled %v times: expected about %v", i, count, expected);
+		};
+	};
+	if items := tree.SampleK(sz + 10, rng); len(items) != sz {
+		t.Errorf("Expected all %v items: got %v", sz, len(items));
+	};
+	if items := Make(true).SampleK(k, rng); len(items) != 0 {
+		t.Errorf("Expected no items from empty tree: got %v", items);
+	};
+};
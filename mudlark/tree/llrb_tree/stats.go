@@ -0,0 +1,60 @@
+// Copyright 2010 -- Peter Williams, all rights reserved
+// Use of this source code is governed by the new BSD license.
+
+package llrb_tree;
+
+import "unsafe";
+
+// Stats describes the shape and size of a tree (see Tree.Stats() and
+// heteroset.Set.Stats(), whose trees hold the sets' members as their items).
+// The depth of an item is the number of nodes on the path from the root to it
+// (so the root's depth is 1) which is the number of nodes examined by Find()
+// to find it.
+type Stats struct {
+	// the number of items in the tree
+	Count uint;
+	// the greatest depth of any item
+	Height uint;
+	// the number of black nodes on every path from the root to a leaf
+	BlackHeight uint;
+	// the number of red nodes
+	RedCount uint;
+	// the mean depth of the items
+	AverageDepth float64;
+	// an estimate of the memory used by the tree excluding that used by the
+	// items themselves
+	Bytes uint64;
+};
+
+func (this *Stats) visit(node *ll_rb_node, depth uint, total_depth *uint64) {
+	if node == nil {
+		return;
+	};
+	if depth > this.Height {
+		this.Height = depth;
+	};
+	if node.red {
+		this.RedCount++;
+	};
+	*total_depth += uint64(depth);
+	this.visit(node.left, depth + 1, total_depth);
+	this.visit(node.right, depth + 1, total_depth);
+};
+
+// Stats examines every node in the tree (without modifying it) and returns a
+// description of the tree's shape.
+func (this *Tree) Stats() (stats Stats) {
+	stats.Count = this.count;
+	for node := this.root; node != nil; node = node.left {
+		if !node.red {
+			stats.BlackHeight++;
+		};
+	};
+	var total_depth uint64;
+	stats.visit(this.root, 1, &total_depth);
+	if this.count > 0 {
+		stats.AverageDepth = float64(total_depth) / float64(this.count);
+	};
+	stats.Bytes = uint64(unsafe.Sizeof(*this)) + uint64(this.count) * uint64(unsafe.Sizeof(ll_rb_node{}));
+	return;
+};
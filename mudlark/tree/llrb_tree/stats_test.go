@@ -0,0 +1,49 @@
+// Copyright 2010 -- Peter Williams, all rights reserved
+// Use of this source code is governed by the new BSD license.
+
+package llrb_tree;
+
+import (
+	"testing";
+	"math";
+	"rand";
+);
+
+func TestStats(t *testing.T) {
+	tree := Make(false);
+	if stats := tree.Stats(); stats.Count != 0 || stats.Height != 0 || stats.AverageDepth != 0 {
+		t.Errorf("Unexpected stats for empty tree: %v", stats);
+	};
+	tree.Insert(Int(1));
+	if stats := tree.Stats(); stats.Height != 1 || stats.BlackHeight != 1 || stats.RedCount != 0 || stats.AverageDepth != 1 {
+		t.Errorf("Unexpected stats for single item tree: %v", stats);
+	};
+	for i := 0; i < 9999; i++ {
+		tree.Insert(Int(rand.Int()));
+	};
+	root := tree.root;
+	stats := tree.Stats();
+	if tree.root != root {
+		t.Errorf("Stats modified the tree");
+	};
+	if stats.Count != 10000 {
+		t.Errorf("Expected count 10000: got %v", stats.Count);
+	};
+	limit := 2 * math.Log2(float64(stats.Count + 1));
+	if float64(stats.Height) > limit || stats.AverageDepth > float64(stats.Height) || stats.AverageDepth < math.Log2(float64(stats.Count)) - 1 {
+		t.Errorf("Implausible depths: %v", stats);
+	};
+	// black_height() counts the nil leaves as black nodes
+	if h := black_height(t, tree.root) - 1; uint(h) != stats.BlackHeight {
+		t.Errorf("Expected black height %v: got %v", h, stats.BlackHeight);
+	};
+	if stats.BlackHeight > stats.Height || stats.Height > 2 * stats.BlackHeight {
+		t.Errorf("Black height %v inconsistent with height %v", stats.BlackHeight, stats.Height);
+	};
+	if stats.RedCount == 0 || stats.RedCount >= stats.Count / 2 {
+		t.Errorf("Implausible red count %v", stats.RedCount);
+	};
+	if stats.Bytes < uint64(stats.Count) * 4 * 8 {
+		t.Errorf("Implausible size %v", stats.Bytes);
+	};
+};
@@ -0,0 +1,104 @@
+// Copyright 2010 -- Peter Williams, all rights reserved
+// Use of this source code is governed by the new BSD license.
+
+package llrb_tree;
+
+import "os";
+
+// ErrConflict is returned by Transaction.Commit() when the tree has been
+// modified since the transaction began.
+var ErrConflict = os.NewError("llrb_tree: tree modified during transaction");
+
+// Transaction is a batch of insertions and deletions that will either all be
+// applied to a Tree (by Commit()) or not at all (by Rollback()).  Until it is
+// committed the batch's effects are only visible via the transaction's own
+// methods.  Instances of Transaction must be created using Tree.Begin().
+//
+// The transaction shares those parts of the tree that it has not modified
+// so beginning one is cheap and committing one is done by replacing the
+// tree's root.
+type Transaction struct {
+	tree *Tree;
+	// the tree's root when the transaction began
+	root *ll_rb_node;
+	// the tree as modified by the transaction
+	view Tree;
+	// the changes made by the transaction for the tree's observers
+	changes recorder;
+};
+
+// Begin a transaction on this tree.
+func (this *Tree) Begin() (txn *Transaction) {
+	txn = new(Transaction);
+	txn.tree = this;
+	txn.root = this.root;
+	txn.view = *this;
+	txn.view.observers = nil;
+	txn.view.AddObserver(&txn.changes);
+	// From now on all existing nodes are shared with the transaction so
+	// both parties need new generations.
+	txn.view.gen = new_generation();
+	this.gen = new_generation();
+	return;
+};
+
+// Find an item in the tree as modified by the transaction.
+func (this *Transaction) Find(item Item) (entry Item, found bool) {
+	return this.view.Find(item);
+};
+
+// Is there an instance equal to item in the tree as modified by the
+// transaction.
+func (this *Transaction) Has(item Item) bool {
+	return this.view.Has(item);
+};
+
+// Insert item in the transaction's batch.  See Tree.Insert().
+func (this *Transaction) Insert(item Item) {
+	this.view.Insert(item);
+};
+
+// Delete item in the transaction's batch.  See Tree.Delete().
+func (this *Transaction) Delete(item Item) {
+	this.view.Delete(item);
+};
+
+// Len returns the number of items in the tree as modified by the
+// transaction.
+func (this *Transaction) Len() uint {
+	return this.view.Len();
+};
+
+// Iterate over the tree as modified by the transaction.  See Tree.Iter().
+func (this *Transaction) Iter(order int) <-chan Item {
+	return this.view.Iter(order);
+};
+
+// Commit applies the transaction's batch to the tree.  If the tree has been
+// modified since the transaction began (including by the commit of another
+// transaction) none of the batch is applied and ErrConflict is returned.
+// Otherwise the tree's observers are notified of each of the batch's changes
+// in the order that they were made.  The transaction must not be used after
+// it has been committed.
+func (this *Transaction) Commit() os.Error {
+	if this.tree.root != this.root {
+		return ErrConflict;
+	};
+	this.tree.root = this.view.root;
+	this.tree.count = this.view.count;
+	this.tree.mod_count = this.view.mod_count;
+	// The tree takes over ownership of the transaction's nodes.
+	this.tree.gen = this.view.gen;
+	for _, c := range this.changes.changes {
+		this.tree.notify(c.old, c.new);
+	};
+	return nil;
+};
+
+// Rollback discards the transaction's batch leaving the tree unchanged.
+// The transaction must not be used after it has been rolled back.
+func (this *Transaction) Rollback() {
+	this.view.root = nil;
+	this.view.count = 0;
+	this.changes.changes = nil;
+};
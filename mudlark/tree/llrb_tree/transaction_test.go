@@ -0,0 +1,182 @@
+// Copyright 2010 -- Peter Williams, all rights reserved
+// Use of this source code is governed by the new BSD license.
+
+package llrb_tree;
+
+import (
+	"testing";
+	"rand";
+);
+
+// Check the left leaning red black invariants and return the black height.
+func black_height(t *testing.T, node *ll_rb_node) int {
+	if node == nil {
+		return 1;
+	};
+	if is_red(node.right) {
+		t.Errorf("Right leaning red link at %v", node.item);
+	};
+	if is_red(node) && is_red(node.left) {
+		t.Errorf("Consecutive red links at %v", node.item);
+	};
+	lh := black_height(t, node.left);
+	rh := black_height(t, node.right);
+	if lh != rh {
+		t.Errorf("Unbalanced at %v: %v != %v", node.item, lh, rh);
+	};
+	if !is_red(node) {
+		lh++;
+	};
+	return lh;
+};
+
+func tree_items(tree *Tree) (items []Item) {
+	items = make([]Item, tree.Len());
+	var i int;
+	for item := range tree.Iter(IN_ORDER) {
+		items[i] = item;
+		i++;
+	};
+	return;
+};
+
+func TestTransactionCommit(t *testing.T) {
+	tree := Make(true);
+	for i := 0; i < 100; i++ {
+		tree.Insert(Int(i));
+	};
+	txn := tree.Begin();
+	for i := 0; i < 100; i += 2 {
+		txn.Delete(Int(i));
+	};
+	for i := 100; i < 150; i++ {
+		txn.Insert(Int(i));
+	};
+	if tree.Len() != 100 || txn.Len() != 100 {
+		t.Errorf("Expected lengths 100 and 100: got %v and %v", tree.Len(), txn.Len());
+	};
+	for i := 0; i < 100; i++ {
+		if !tree.Has(Int(i)) {
+			t.Errorf("Transaction changed tree before commit: %v missing", i);
+		};
+		if txn.Has(Int(i)) != (i % 2 == 1) {
+			t.Errorf("Transaction view wrong for %v", i);
+		};
+	};
+	if tree.Has(Int(120)) || !txn.Has(Int(120)) {
+		t.Errorf("Transaction view wrong for 120");
+	};
+	if err := txn.Commit(); err != nil {
+		t.Errorf("Unexpected commit error: %v", err);
+	};
+	if tree.Len() != 100 {
+		t.Errorf("Expected length 100: got %v", tree.Len());
+	};
+	for i := 0; i < 150; i++ {
+		if tree.Has(Int(i)) != (i >= 100 || i % 2 == 1) {
+			t.Errorf("Committed tree wrong for %v", i);
+		};
+	};
+	black_height(t, tree.root);
+};
+
+func TestTransactionRollback(t *testing.T) {
+	tree := Make(false);
+	for i := 0; i < 100; i++ {
+		tree.Insert(Int(i % 50));
+	};
+	before := tree_items(tree);
+	txn := tree.Begin();
+	for i := 0; i < 100; i++ {
+		txn.Delete(Int(i % 50));
+		txn.Insert(Int(rand.Intn(50)));
+	};
+	txn.Rollback();
+	after := tree_items(tree);
+	if len(before) != len(after) {
+		t.Errorf("Rollback changed length: %v != %v", len(before), len(after));
+	};
+	for i := range before {
+		if before[i] != after[i] {
+			t.Errorf("Rollback changed item %v: %v != %v", i, before[i], after[i]);
+		};
+	};
+	black_height(t, tree.root);
+};
+
+func TestTransactionConflict(t *testing.T) {
+	tree := Make(true);
+	for i := 0; i < 100; i++ {
+		tree.Insert(Int(i));
+	};
+	txn1 := tree.Begin();
+	txn2 := tree.Begin();
+	txn1.Insert(Int(1000));
+	txn2.Delete(Int(50));
+	if err := txn1.Commit(); err != nil {
+		t.Errorf("Unexpected commit error: %v", err);
+	};
+	if err := txn2.Commit(); err != ErrConflict {
+		t.Errorf("Expected %v: got %v", ErrConflict, err);
+	};
+	if !tree.Has(Int(1000)) || !tree.Has(Int(50)) {
+		t.Errorf("Conflicting commit applied");
+	};
+	txn3 := tree.Begin();
+	txn3.Insert(Int(2000));
+	tree.Insert(Int(5));
+	if err := txn3.Commit(); err != ErrConflict {
+		t.Errorf("Expected %v: got %v", ErrConflict, err);
+	};
+	if tree.Has(Int(2000)) {
+		t.Errorf("Conflicting commit applied");
+	};
+};
+
+// Changes to the tree and to its transactions must not leak into each other
+// via the nodes that they share.
+func TestTransactionIsolation(t *testing.T) {
+	tree := Make(true);
+	expected := make(map[int]bool);
+	for i := 0; i < 1000; i++ {
+		n := rand.Intn(500);
+		tree.Insert(Int(n));
+		expected[n] = true;
+	};
+	txn := tree.Begin();
+	txn_expected := make(map[int]bool);
+	for n := range expected {
+		txn_expected[n] = true;
+	};
+	for i := 0; i < 1000; i++ {
+		n := rand.Intn(500);
+		if rand.Intn(2) == 0 {
+			tree.Insert(Int(n));
+			expected[n] = true;
+		} else {
+			tree.Delete(Int(n));
+			expected[n] = false, false;
+		};
+		n = rand.Intn(500);
+		if rand.Intn(2) == 0 {
+			txn.Insert(Int(n));
+			txn_expected[n] = true;
+		} else {
+			txn.Delete(Int(n));
+			txn_expected[n] = false, false;
+		};
+	};
+	for n := 0; n < 500; n++ {
+		if tree.Has(Int(n)) != expected[n] {
+			t.Errorf("Tree wrong for %v", n);
+		};
+		if txn.Has(Int(n)) != txn_expected[n] {
+			t.Errorf("Transaction wrong for %v", n);
+		};
+	};
+	if tree.Len() != uint(len(expected)) || txn.Len() != uint(len(txn_expected)) {
+		t.Errorf("Lengths wrong: %v, %v", tree.Len(), txn.Len());
+	};
+	black_height(t, tree.root);
+	black_height(t, txn.view.root);
+};
@@ -0,0 +1,179 @@
+// Copyright 2010 -- Peter Williams, all rights reserved
+// Use of this source code is governed by the new BSD license.
+
+package llrb_tree;
+
+// A retained version of a Versioned tree.
+type version struct {
+	number uint;
+	root *ll_rb_node;
+	count uint;
+};
+
+// Versioned is a Tree that retains its earlier versions so that its contents
+// as they were at any retained version can be examined.  Every insertion or
+// deletion creates a new version whose number is one greater than that of
+// the previous version (the empty tree is version 0).
+//
+// Versions share those parts of the tree that they have in common so each
+// new version costs O(log N) extra memory.  How many past versions are kept
+// can be limited using SetRetention() and Compact().  Instances of Versioned
+// must be initialized using MakeVersioned() before use.
+type Versioned struct {
+	current Tree;
+	// the retained versions, oldest first (the last is the current version)
+	history []version;
+	// the maximum number of versions to retain (0 means no limit)
+	retention uint;
+};
+
+// Make a Versioned tree. The parameter "filtered" determines whether
+// duplicate items will be filtered out (or kept) during insertion.
+func MakeVersioned(filtered bool) (tree *Versioned) {
+	tree = new(Versioned);
+	tree.current.keep_duplicates = !filtered;
+	tree.history = []version{version{0, nil, 0}};
+	return;
+};
+
+// Version returns the number of the current version.
+func (this *Versioned) Version() uint {
+	return this.history[len(this.history) - 1].number;
+};
+
+// Oldest returns the number of the oldest version still retained.
+func (this *Versioned) Oldest() uint {
+	return this.history[0].number;
+};
+
+// Find an item in the current version of the tree.
+func (this *Versioned) Find(item Item) (entry Item, found bool) {
+	return this.current.Find(item);
+};
+
+// Is there an instance equal to item in the current version of the tree.
+func (this *Versioned) Has(item Item) bool {
+	return this.current.Has(item);
+};
+
+// Len returns the number of items in the current version of the tree.
+func (this *Versioned) Len() uint {
+	return this.current.Len();
+};
+
+// Iterate over the current version of the tree.  See Tree.Iter().  To
+// iterate over the current version while modifying the tree use the Tree
+// returned by AsOf(Version()).
+func (this *Versioned) Iter(order int) <-chan Item {
+	return this.current.Iter(order);
+};
+
+func (this *Versioned) record() {
+	this.history = append(this.history, version{this.Version() + 1, this.current.root, this.current.count});
+	if this.retention != 0 && uint(len(this.history)) > this.retention {
+		this.Compact(this.history[uint(len(this.history)) - this.retention].number);
+	};
+};
+
+// Insert item in the tree creating a new version.  See Tree.Insert().
+func (this *Versioned) Insert(item Item) (number uint) {
+	// Nodes belonging to earlier versions must not be modified.
+	this.current.gen = new_generation();
+	this.current.Insert(item);
+	this.record();
+	return this.Version();
+};
+
+// Delete item from the tree creating a new version if the item was in the
+// tree.  See Tree.Delete().
+func (this *Versioned) Delete(item Item) (number uint) {
+	root, count := this.current.root, this.current.count;
+	this.current.gen = new_generation();
+	this.current.Delete(item);
+	if this.current.count == count {
+		// Nothing was deleted so discard the copied nodes.
+		this.current.root = root;
+	} else {
+		this.record();
+	};
+	return this.Version();
+};
+
+// AsOf returns a Tree containing the contents of the tree as they were at the
+// given version.  If that version is no longer (or not yet) retained found
+// will be false.  The returned Tree shares its nodes with this one but may be
+// freely modified without affecting it (or vice versa).
+func (this *Versioned) AsOf(number uint) (tree *Tree, found bool) {
+	if number < this.Oldest() || number > this.Version() {
+		return;
+	};
+	v := this.history[number - this.Oldest()];
+	tree = Make(!this.current.keep_duplicates);
+	tree.root = v.root;
+	tree.count = v.count;
+	tree.gen = new_generation();
+	return tree, true;
+};
+
+// Find an item in the tree as it was at the given version.  If that version is
+// no longer retained found will be false.
+func (this *Versioned) FindAsOf(number uint, item Item) (entry Item, found bool) {
+	if tree, ok := this.AsOf(number); ok {
+		return tree.Find(item);
+	};
+	return;
+};
+
+// Iterate over the tree as it was at the given version.  See Tree.Iter().  If
+// that version is no longer retained the iteration will be empty.
+func (this *Versioned) IterAsOf(number uint, order int) <-chan Item {
+	tree, _ := this.AsOf(number);
+	if tree == nil {
+		tree = Make(true);
+	};
+	return tree.Iter(order);
+};
+
+// AddObserver registers observer to be notified of changes to the tree's
+// contents.  See Tree.AddObserver().
+func (this *Versioned) AddObserver(observer Observer) (id uint) {
+	return this.current.AddObserver(observer);
+};
+
+// RemoveObserver unregisters the observer with the given id.
+func (this *Versioned) RemoveObserver(id uint) {
+	this.current.RemoveObserver(id);
+};
+
+// Instrument makes the tree count its operations in metrics.  See
+// Tree.Instrument().
+func (this *Versioned) Instrument(metrics *Metrics) {
+	this.current.Instrument(metrics);
+};
+
+// SetRetention limits the number of versions retained (including the current
+// version) to at most n discarding the oldest versions if necessary.  A
+// limit of 0 means that all versions are retained.
+func (this *Versioned) SetRetention(n uint) {
+	this.retention = n;
+	if n != 0 && uint(len(this.history)) > n {
+		this.Compact(this.history[uint(len(this.history)) - n].number);
+	};
+};
+
+// Compact discards all versions older than the given version.  The current
+// version is never discarded.
+func (this *Versioned) Compact(oldest uint) {
+	if oldest > this.Version() {
+		oldest = this.Version();
+	};
+	if oldest <= this.Oldest() {
+		return;
+	};
+	discard := oldest - this.Oldest();
+	// Make sure that the discarded versions' nodes can be garbage collected.
+	for i := uint(0); i < discard; i++ {
+		this.history[i].root = nil;
+	};
+	this.history = this.history[discard:];
+};
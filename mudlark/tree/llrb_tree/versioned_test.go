@@ -0,0 +1,121 @@
+// Copyright 2010 -- Peter Williams, all rights reserved
+// Use of this source code is governed by the new BSD license.
+
+package llrb_tree;
+
+import (
+	"testing";
+	"rand";
+);
+
+func TestVersionedAsOf(t *testing.T) {
+	tree := MakeVersioned(true);
+	if tree.Version() != 0 {
+		t.Errorf("Expected version 0: got %v", tree.Version());
+	};
+	// contents[v] records the expected contents at version v
+	contents := []map[int]bool{make(map[int]bool)};
+	for i := 0; i < 500; i++ {
+		next := make(map[int]bool);
+		for n := range contents[len(contents) - 1] {
+			next[n] = true;
+		};
+		n := rand.Intn(100);
+		var number uint;
+		if rand.Intn(3) == 0 {
+			if !next[n] {
+				if tree.Delete(Int(n)) != tree.Version() || tree.Version() != uint(len(contents) - 1) {
+					t.Errorf("Deleting absent %v created a version", n);
+				};
+				continue;
+			};
+			number = tree.Delete(Int(n));
+			next[n] = false, false;
+		} else {
+			number = tree.Insert(Int(n));
+			next[n] = true;
+		};
+		contents = append(contents, next);
+		if number != uint(len(contents) - 1) {
+			t.Errorf("Expected version %v: got %v", len(contents) - 1, number);
+		};
+	};
+	for number, expected := range contents {
+		old, found := tree.AsOf(uint(number));
+		if !found {
+			t.Errorf("Version %v not found", number);
+			continue;
+		};
+		if old.Len() != uint(len(expected)) {
+			t.Errorf("Version %v: expected length %v got %v", number, len(expected), old.Len());
+		};
+		for n := 0; n < 100; n++ {
+			if _, found := tree.FindAsOf(uint(number), Int(n)); found != expected[n] {
+				t.Errorf("Version %v: wrong for %v", number, n);
+			};
+		};
+		count := 0;
+		for item := range tree.IterAsOf(uint(number), IN_ORDER) {
+			if !expected[int(item.(Int))] {
+				t.Errorf("Version %v: unexpected %v", number, item);
+			};
+			count++;
+		};
+		if count != len(expected) {
+			t.Errorf("Version %v: expected %v items got %v", number, len(expected), count);
+		};
+		black_height(t, old.root);
+	};
+};
+
+func TestVersionedAsOfModify(t *testing.T) {
+	tree := MakeVersioned(true);
+	for i := 0; i < 100; i++ {
+		tree.Insert(Int(i));
+	};
+	old, _ := tree.AsOf(50);
+	for i := 0; i < 50; i++ {
+		old.Delete(Int(i));
+	};
+	old.Insert(Int(1000));
+	if tree.Len() != 100 || tree.Has(Int(1000)) {
+		t.Errorf("Modifying an old version changed the current version");
+	};
+	if again, _ := tree.AsOf(50); again.Len() != 50 || again.Has(Int(1000)) {
+		t.Errorf("Modifying an old version changed the retained version");
+	};
+};
+
+func TestVersionedRetention(t *testing.T) {
+	tree := MakeVersioned(false);
+	for i := 0; i < 100; i++ {
+		tree.Insert(Int(i));
+	};
+	tree.Compact(40);
+	if tree.Oldest() != 40 {
+		t.Errorf("Expected oldest version 40: got %v", tree.Oldest());
+	};
+	if _, found := tree.AsOf(39); found {
+		t.Errorf("Compacted version 39 still found");
+	};
+	if old, found := tree.AsOf(40); !found || old.Len() != 40 {
+		t.Errorf("Version 40 lost by compaction");
+	};
+	tree.SetRetention(10);
+	if tree.Oldest() != 91 {
+		t.Errorf("Expected oldest version 91: got %v", tree.Oldest());
+	};
+	for i := 0; i < 100; i++ {
+		tree.Insert(Int(i));
+	};
+	if tree.Oldest() != 191 || tree.Version() != 200 {
+		t.Errorf("Expected versions 191 to 200: got %v to %v", tree.Oldest(), tree.Version());
+	};
+	tree.Compact(1000);
+	if tree.Oldest() != tree.Version() || tree.Len() != 200 {
+		t.Errorf("Compaction discarded the current version");
+	};
+	if _, found := tree.AsOf(201); found {
+		t.Errorf("Future version found");
+	};
+};
@@ -0,0 +1,200 @@
+// Copyright 2010 -- Peter Williams, all rights reserved
+// Use of this source code is governed by the new BSD license.
+
+// The multi_index package implements collections of records that can be
+// looked up and iterated over in several different orders (e.g. by id, by
+// time stamp and by name).  Each ordering is kept in its own left leaning red
+// black tree (see mudlark/tree/llrb_tree) and every change to the collection
+// is applied to all of the trees or to none of them.
+package multi_index;
+
+import "mudlark/tree/llrb_tree";
+
+// Less is the type of the functions that define the orderings of a
+// Collection.  Like Item.Precedes() it must define a strict weak ordering.
+type Less func(a, b interface{}) bool;
+
+// ByItem returns a Less that orders records by the Item that key extracts
+// from them (e.g. a field whose type implements llrb_tree.Item).
+func ByItem(key func(record interface{}) llrb_tree.Item) Less {
+	return func(a, b interface{}) bool {
+		return key(a).Precedes(key(b));
+	};
+};
+
+// Where a probe lies relative to the records whose keys are equal to its own.
+const (
+	bound_before = -1;
+	bound_none = 0;
+	bound_after = 1;
+);
+
+type index struct {
+	less Less;
+	tree *llrb_tree.Tree;
+};
+
+// The items kept in the trees.  Records whose keys are equal in a secondary
+// index are ordered by the primary index so that each entry is unique.
+type entry struct {
+	record interface{};
+	index *index;
+	primary Less;
+	bound int;
+};
+
+func (this *entry) Precedes(other interface{}) bool {
+	that := other.(*entry);
+	if this.index.less(this.record, that.record) {
+		return true;
+	} else if this.index.less(that.record, this.record) {
+		return false;
+	};
+	if this.bound != that.bound {
+		return this.bound < that.bound;
+	};
+	return this.primary != nil && this.primary(this.record, that.record);
+};
+
+// Collection is a set of records ordered in several ways.  The first ordering
+// (index 0) is the primary index and no two records in the collection are
+// equal according to it.  The remaining orderings are secondary indexes which
+// may contain any number of equal records.  Instances of Collection must be
+// created using Make().
+//
+// A record's place in each index is decided by its contents when it is
+// inserted so records must not be modified in place while they are in the
+// collection: the indexes would be left out of order and the stale entries
+// couldn't be found (by Update() or Delete()) to be removed.  To change a
+// record Update() the collection with a modified copy of it.  A Collection is
+// not safe for concurrent use.
+type Collection struct {
+	indexes []*index;
+};
+
+// Make a Collection with the given primary and secondary orderings.  The
+// secondary orderings are numbered from 1 in the order given.
+func Make(primary Less, secondary ...Less) (collection *Collection) {
+	collection = new(Collection);
+	collection.indexes = make([]*index, 1 + len(secondary));
+	collection.indexes[0] = &index{primary, llrb_tree.Make(true)};
+	for i, less := range secondary {
+		collection.indexes[i + 1] = &index{less, llrb_tree.Make(true)};
+	};
+	return;
+};
+
+func (this *Collection) entry(i int, record interface{}, bound int) *entry {
+	e := &entry{record, this.indexes[i], nil, bound};
+	if i != 0 {
+		e.primary = this.indexes[0].less;
+	};
+	return e;
+};
+
+// Replace old (if not nil) with new (if not nil) in every index.  The changes
+// are made in transactions that are only committed once all of them have
+// been made so that a panicking Less function leaves the collection unchanged.
+func (this *Collection) replace(old, new interface{}) {
+	txns := make([]*llrb_tree.Transaction, len(this.indexes));
+	for i, index := range this.indexes {
+		txns[i] = index.tree.Begin();
+		if old != nil {
+			txns[i].Delete(this.entry(i, old, bound_none));
+		};
+		if new != nil {
+			txns[i].Insert(this.entry(i, new, bound_none));
+		};
+	};
+	for _, txn := range txns {
+		// The collection is the trees' only user so a conflict means
+		// that it has been used concurrently.
+		if err := txn.Commit(); err != nil {
+			panic(err);
+		};
+	};
+};
+
+// Get the record equal to key in the primary index.
+func (this *Collection) Get(key interface{}) (record interface{}, found bool) {
+	item, found := this.indexes[0].tree.Find(this.entry(0, key, bound_none));
+	if found {
+		record = item.(*entry).record;
+	};
+	return;
+};
+
+// Insert record in the collection replacing any record that is equal to it in
+// the primary index.
+func (this *Collection) Insert(record interface{}) {
+	old, _ := this.Get(record);
+	this.replace(old, record);
+};
+
+// Update replaces the record that is equal to record in the primary index
+// with record.  If there is no such record the collection is unchanged and
+// found is false.  record must be a new value (e.g. a modified copy) rather
+// than the record in the collection modified in place (see Collection).
+func (this *Collection) Update(record interface{}) (found bool) {
+	old, found := this.Get(record);
+	if found {
+		this.replace(old, record);
+	};
+	return;
+};
+
+// Delete the record that is equal to key in the primary index.  If there is
+// no such record the collection is unchanged and found is false.
+func (this *Collection) Delete(key interface{}) (found bool) {
+	old, found := this.Get(key);
+	if found {
+		this.replace(old, nil);
+	};
+	return;
+};
+
+// Len returns the number of records in the collection.
+func (this *Collection) Len() uint {
+	return this.indexes[0].tree.Len();
+};
+
+// Find the records that are equal to key in the given index.  They are
+// returned in the order of the primary index.
+func (this *Collection) Find(index int, key interface{}) (records []interface{}) {
+	lo, hi := this.entry(index, key, bound_before), this.entry(index, key, bound_after);
+	for item := range this.indexes[index].tree.IterRange(lo, hi) {
+		records = append(records, item.(*entry).record);
+	};
+	return;
+};
+
+func unwrap(in <-chan llrb_tree.Item) <-chan interface{} {
+	out := make(chan interface{});
+	go func() {
+		for item := range in {
+			out <- item.(*entry).record;
+		};
+		close(out);
+	}();
+	return out;
+};
+
+// Range iterates in the order of the given index over the records whose keys
+// do not precede lo's and precede hi's.  A nil lo or hi means that the range
+// is unbounded at that end.
+func (this *Collection) Range(index int, lo, hi interface{}) <-chan interface{} {
+	var lo_entry, hi_entry llrb_tree.Item;
+	if lo != nil {
+		lo_entry = this.entry(index, lo, bound_before);
+	};
+	if hi != nil {
+		hi_entry = this.entry(index, hi, bound_before);
+	};
+	return unwrap(this.indexes[index].tree.IterRange(lo_entry, hi_entry));
+};
+
+// Iterate over the records in the order of the given index.  See
+// llrb_tree.Tree.Iter() for the meaning of order.
+func (this *Collection) Iter(index int, order int) <-chan interface{} {
+	return unwrap(this.indexes[index].tree.Iter(order));
+};
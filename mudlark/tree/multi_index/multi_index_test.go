@@ -0,0 +1,145 @@
+// Copyright 2010 -- Peter Williams, all rights reserved
+// Use of this source code is governed by the new BSD license.
+
+package multi_index;
+
+import (
+	"testing";
+	"rand";
+	"fmt";
+	"mudlark/tree/llrb_tree";
+);
+
+type person struct {
+	id int;
+	age int;
+	name string;
+};
+
+const (
+	by_id = iota;
+	by_age;
+	by_name;
+);
+
+func make_people() *Collection {
+	return Make(
+		func(a, b interface{}) bool { return a.(*person).id < b.(*person).id; },
+		func(a, b interface{}) bool { return a.(*person).age < b.(*person).age; },
+		func(a, b interface{}) bool { return a.(*person).name < b.(*person).name; });
+};
+
+func ids(records []interface{}) (result []int) {
+	for _, r := range records {
+		result = append(result, r.(*person).id);
+	};
+	return;
+};
+
+func chan_ids(c <-chan interface{}) (result []int) {
+	for r := range c {
+		result = append(result, r.(*person).id);
+	};
+	return;
+};
+
+func check_ids(t *testing.T, what string, expected, got []int) {
+	if fmt.Sprint(expected) != fmt.Sprint(got) {
+		t.Errorf("%v: expected %v got %v", what, expected, got);
+	};
+};
+
+// Each index should contain exactly the records in the primary index.
+func check_consistent(t *testing.T, c *Collection) {
+	for i, index := range c.indexes {
+		if index.tree.Len() != c.Len() {
+			t.Errorf("Index %v has %v records: expected %v", i, index.tree.Len(), c.Len());
+		};
+		var last *entry;
+		for item := range index.tree.Iter(llrb_tree.IN_ORDER) {
+			e := item.(*entry);
+			if r, found := c.Get(e.record); !found || r != e.record {
+				t.Errorf("Index %v has stale record %v", i, e.record);
+			};
+			if last != nil && !last.Precedes(e) {
+				t.Errorf("Index %v out of order at %v", i, e.record);
+			};
+			last = e;
+		};
+	};
+};
+
+func TestCollection(t *testing.T) {
+	c := make_people();
+	c.Insert(&person{3, 30, "carol"});
+	c.Insert(&person{1, 40, "alice"});
+	c.Insert(&person{2, 30, "bob"});
+	c.Insert(&person{4, 20, "bob"});
+	check_consistent(t, c);
+	check_ids(t, "by age", []int{4, 2, 3, 1}, chan_ids(c.Iter(by_age, llrb_tree.IN_ORDER)));
+	check_ids(t, "by name", []int{1, 2, 4, 3}, chan_ids(c.Iter(by_name, llrb_tree.IN_ORDER)));
+	check_ids(t, "age 30", []int{2, 3}, ids(c.Find(by_age, &person{age: 30})));
+	check_ids(t, "bob", []int{2, 4}, ids(c.Find(by_name, &person{name: "bob"})));
+	check_ids(t, "dave", nil, ids(c.Find(by_name, &person{name: "dave"})));
+	check_ids(t, "ages [20, 40)", []int{4, 2, 3}, chan_ids(c.Range(by_age, &person{age: 20}, &person{age: 40})));
+	check_ids(t, "names from c", []int{3}, chan_ids(c.Range(by_name, &person{name: "c"}, nil)));
+	if !c.Update(&person{2, 50, "bob"}) {
+		t.Errorf("Update of existing record failed");
+	};
+	if c.Update(&person{5, 50, "eve"}) {
+		t.Errorf("Update of absent record succeeded");
+	};
+	check_ids(t, "age 30 after update", []int{3}, ids(c.Find(by_age, &person{age: 30})));
+	check_ids(t, "age 50 after update", []int{2}, ids(c.Find(by_age, &person{age: 50})));
+	c.Insert(&person{3, 20, "carl"});
+	check_ids(t, "age 20 after insert", []int{3, 4}, ids(c.Find(by_age, &person{age: 20})));
+	if !c.Delete(&person{id: 4}) || c.Delete(&person{id: 4}) {
+		t.Errorf("Delete returned wrong result");
+	};
+	check_ids(t, "bob after delete", []int{2}, ids(c.Find(by_name, &person{name: "bob"})));
+	check_consistent(t, c);
+	if c.Len() != 3 {
+		t.Errorf("Expected 3 records: got %v", c.Len());
+	};
+};
+
+func TestCollectionRandom(t *testing.T) {
+	c := make_people();
+	for i := 0; i < 2000; i++ {
+		id := rand.Intn(100);
+		switch rand.Intn(3) {
+		case 0:
+			c.Insert(&person{id, rand.Intn(10), fmt.Sprint(rand.Intn(10))});
+		case 1:
+			c.Update(&person{id, rand.Intn(10), fmt.Sprint(rand.Intn(10))});
+		case 2:
+			c.Delete(&person{id: id});
+		};
+	};
+	check_consistent(t, c);
+};
+
+func TestCollectionAtomic(t *testing.T) {
+	c := Make(
+		func(a, b interface{}) bool { return a.(int) < b.(int); },
+		func(a, b interface{}) bool {
+			if a.(int) == 13 || b.(int) == 13 {
+				panic("unlucky");
+			};
+			return a.(int) < b.(int);
+		});
+	for i := 0; i < 10; i++ {
+		c.Insert(i);
+	};
+	func() {
+		defer func() { recover(); }();
+		c.Insert(13);
+	}();
+	check_consistent(t, c);
+	if c.Len() != 10 {
+		t.Errorf("Expected 10 records: got %v", c.Len());
+	};
+	if _, found := c.Get(13); found {
+		t.Errorf("Failed insertion partly applied");
+	};
+};